@@ -1,22 +1,36 @@
 package main
 
 import (
+	"fmt"
 	"sync"
 	"time"
+
+	"ana/trace"
 )
 
-// 聚合结构（读写计数）
+// 聚合结构（读写计数与字节数）
 type CountPair struct {
-	Reads  int64
-	Writes int64
+	Reads      int64
+	Writes     int64
+	ReadBytes  int64
+	WriteBytes int64
+}
+
+func (cp *CountPair) add(isRead bool, size int64) {
+	if isRead {
+		cp.Reads++
+		cp.ReadBytes += size
+	} else {
+		cp.Writes++
+		cp.WriteBytes += size
+	}
 }
 
-type StripeOperation struct {
-	StripeID   int64
-	BlockIndex int
-	BlockType  string // "Data" or "Parity"
-	ReadWrite  string // "Read" or "Write"
-	OptionTime time.Time
+func (cp *CountPair) merge(o *CountPair) {
+	cp.Reads += o.Reads
+	cp.Writes += o.Writes
+	cp.ReadBytes += o.ReadBytes
+	cp.WriteBytes += o.WriteBytes
 }
 
 // 全局统计容器（并发安全通过 mutex）
@@ -34,30 +48,42 @@ type Aggregator struct {
 
 	minuteOrder        []string
 	minuteBufLimit     int
-	onEvict            func(string, map[string]*CountPair)
+	onEvict            func(string, map[string]*CountPair, bool)
 	enableMinuteVolume bool
+	// 已淘汰过的分钟（由 minuteVolMu 保护）。各 worker 分批合并，已淘汰的分钟可能被后来的合并重新带回，
+	// 再次淘汰或最终写出时需要与已写出的文件合并
+	evictedMinutes map[string]bool
+	evictMu        sync.Mutex // 让淘汰回调按淘汰顺序依次执行
 
 	volMu  sync.RWMutex
 	volMap map[string]*CountPair // key: VolumeID
+	// 实际出现的最早/最晚时间戳，用于计算卷的平均吞吐
+	firstTs time.Time
+	lastTs  time.Time
 
 	hasStart bool
 	start    time.Time
 	hasEnd   bool
 	end      time.Time
 
-	stripeMu        sync.Mutex
-	targetVolume    string
-	stripeUpdateMap map[int]int // Key: Number of blocks updated (1-10), Value: Count
+	// 条带分析：命中 targets 的每个卷 × 每个条带配置一份统计
+	targets    *volumeSelector
+	stripeCfgs []StripeConfig
+	stripesMu  sync.RWMutex
+	volStripes map[string][]*stripeState // 未命中的卷记为 nil，避免重复匹配
+	opsBudget  *opsBudget                // stripe_ops 内存预算，nil 表示不落盘
+
+	coalesceWindows []time.Duration // 写合并模拟的窗口
 
-	// map[StripeID][]CountPair
-	// Index 0-(DataBlocks-1): Data Blocks
-	// Index DataBlocks-(TotalBlocks-1): Parity Blocks
-	stripeBlockHeatMap map[int64][]CountPair
-	blockSize          int64
-	dataBlocks         int
-	parityBlocks       int
+	latency *latencyStats
+	ioSize  *ioSizeStats
 
-	stripeOps []StripeOperation
+	seq        *seqStats        // nil 表示未启用
+	workingSet *workingSetStats // nil 表示未启用
+	hot        *hotStats        // nil 表示未启用
+	lbaHeat    *lbaHeatmap      // nil 表示未启用
+
+	cache *cacheStats // 非 nil 时处于 cache 子命令模式，只做缓存分析
 }
 
 func NewAggregator() *Aggregator {
@@ -67,32 +93,102 @@ func NewAggregator() *Aggregator {
 		minuteMap:          make(map[string]*CountPair),
 		minuteVolMap:       make(map[string]map[string]*CountPair),
 		minuteOrder:        make([]string, 0, 256),
+		evictedMinutes:     make(map[string]bool),
 		minuteBufLimit:     240,
 		enableMinuteVolume: true,
 		volMap:             make(map[string]*CountPair),
-		stripeUpdateMap:    make(map[int]int),
-		stripeBlockHeatMap: make(map[int64][]CountPair),
-		stripeOps:          make([]StripeOperation, 0),
-		blockSize:          64 * 1024,
-		dataBlocks:         10,
-		parityBlocks:       4,
+		stripeCfgs:         []StripeConfig{{BlockSize: 64 * 1024, DataBlocks: 10, ParityBlocks: 4}},
+		volStripes:         make(map[string][]*stripeState),
+		latency:            newLatencyStats(),
+		ioSize:             newIOSizeStats(),
+	}
+}
+
+func (ag *Aggregator) SetMinuteBufLimit(n int)        { ag.minuteBufLimit = n }
+func (ag *Aggregator) EnableMinuteVolume(enable bool) { ag.enableMinuteVolume = enable }
+
+// SetOnEvict 设置分钟×卷缓冲的淘汰回调，again 为 true 表示该分钟之前已淘汰写出过
+func (ag *Aggregator) SetOnEvict(fn func(minuteKey string, mv map[string]*CountPair, again bool)) {
+	ag.onEvict = fn
+}
+
+// evictedBefore 报告分钟 minuteKey 是否已淘汰过
+func (ag *Aggregator) evictedBefore(minuteKey string) bool {
+	ag.minuteVolMu.RLock()
+	defer ag.minuteVolMu.RUnlock()
+	return ag.evictedMinutes[minuteKey]
+}
+
+// SetTargets 设置参与条带分析的卷，nil 表示不做条带分析
+func (ag *Aggregator) SetTargets(sel *volumeSelector) {
+	ag.targets = sel
+	ag.volStripes = make(map[string][]*stripeState)
+}
+
+// SetStripeConfigs 设置多个条带配置，目标卷的每条记录会在一次读取中分发给所有配置
+func (ag *Aggregator) SetStripeConfigs(cfgs []StripeConfig) {
+	ag.stripeCfgs = append([]StripeConfig(nil), cfgs...)
+	ag.volStripes = make(map[string][]*stripeState)
+}
+
+// SetCoalesceWindows 设置条带写合并模拟的窗口列表（窗口 0 的基线总会输出）
+func (ag *Aggregator) SetCoalesceWindows(windows []time.Duration) { ag.coalesceWindows = windows }
+
+// EnableSequential 开启顺序/跨步流检测，每卷每个方向跟踪 maxStreams 个流，跨步不超过 strideWindow 字节
+func (ag *Aggregator) EnableSequential(maxStreams int, strideWindow int64) {
+	ag.seq = newSeqStats(maxStreams, strideWindow)
+}
+
+// EnableWorkingSet 开启 footprint 统计，单个集合超过 exactLimit 个 block 后改用 HyperLogLog 估计
+func (ag *Aggregator) EnableWorkingSet(blockSize, exactLimit int64) {
+	if blockSize <= 0 {
+		blockSize = 4096
+	}
+	ag.workingSet = newWorkingSetStats(blockSize, exactLimit, 12)
+}
+
+// EnableHotSpots 开启全卷 top-k 热点条带/block 统计，条带按 blockSize × dataBlocks 划分
+func (ag *Aggregator) EnableHotSpots(k int, blockSize int64, dataBlocks, cmsWidth int) {
+	if blockSize <= 0 {
+		blockSize = 64 * 1024
+	}
+	if dataBlocks <= 0 {
+		dataBlocks = 1
+	}
+	if cmsWidth <= 0 {
+		cmsWidth = 1 << 16
+	}
+	ag.hot = newHotStats(k, blockSize, dataBlocks, 4, cmsWidth)
+}
+
+// EnableLBAHeatmap 对 sel 选中的卷按 bucket 时间桶 × binSize 地址分箱统计热力图
+func (ag *Aggregator) EnableLBAHeatmap(sel *volumeSelector, binSize int64, bucket time.Duration) {
+	if binSize <= 0 {
+		binSize = 256 << 20
 	}
+	if bucket <= 0 {
+		bucket = time.Minute
+	}
+	ag.lbaHeat = newLBAHeatmap(sel, binSize, bucket)
 }
 
-func (ag *Aggregator) SetTargetVolume(vol string)                        { ag.targetVolume = vol }
-func (ag *Aggregator) SetMinuteBufLimit(n int)                           { ag.minuteBufLimit = n }
-func (ag *Aggregator) EnableMinuteVolume(enable bool)                    { ag.enableMinuteVolume = enable }
-func (ag *Aggregator) SetOnEvict(fn func(string, map[string]*CountPair)) { ag.onEvict = fn }
-func (ag *Aggregator) SetStripeConfig(blockSize int64, dataBlocks, parityBlocks int) {
-	if blockSize > 0 {
-		ag.blockSize = blockSize
+// EnableCacheAnalysis 进入 cache 子命令模式：记录只用于 reuse distance / MRC 分析
+func (ag *Aggregator) EnableCacheAnalysis(blockSize int64, rate float64, maxKeys int) {
+	if blockSize <= 0 {
+		blockSize = 4096
 	}
-	if dataBlocks > 0 {
-		ag.dataBlocks = dataBlocks
+	if maxKeys <= 0 {
+		maxKeys = 1 << 16
 	}
-	if parityBlocks >= 0 {
-		ag.parityBlocks = parityBlocks
+	ag.cache = newCacheStats(blockSize, rate, maxKeys)
+}
+
+// SetCacheSimulation 在 cache 模式下按策略 × 容量回放缓存，bucketFmt 为时间桶的 time.Format 布局
+func (ag *Aggregator) SetCacheSimulation(policies []string, sizes []int64, bucketFmt string, writeModes []string) error {
+	if ag.cache == nil {
+		return fmt.Errorf("cache simulation requires cache mode")
 	}
+	return ag.cache.setSimulation(policies, sizes, bucketFmt, writeModes)
 }
 func (ag *Aggregator) SetTimeRange(from, to *time.Time) {
 	if from != nil {
@@ -109,172 +205,53 @@ func (ag *Aggregator) SetTimeRange(from, to *time.Time) {
 	}
 }
 
-func (ag *Aggregator) addRecord(ts time.Time, ioType string, vol string, offset, size int64) {
-	// normalize ioType to "0" (read) or "1" (write)
-	ioType = normalizeIOType(ioType)
+// blockRange 返回 [offset, offset+size) 覆盖的首尾 block 编号
+func blockRange(offset, size int64, blockSize int64) (int64, int64) {
+	return offset / blockSize, (offset + size - 1) / blockSize
+}
+
+// accept 判断记录是否落在 -from/-to 范围内
+func (ag *Aggregator) accept(ts time.Time) bool {
 	if ag.hasStart && ts.Before(ag.start) {
-		return
+		return false
 	}
 	if ag.hasEnd && ts.After(ag.end) {
-		return
+		return false
 	}
+	return true
+}
 
-	if ag.targetVolume != "" && vol == ag.targetVolume {
-		// Stripe analysis logic
-		totalBlocks := int64(ag.dataBlocks + ag.parityBlocks)
-
-		startBlock := offset / ag.blockSize
-		endBlock := (offset + size - 1) / ag.blockSize
-
-		// map[StripeID] -> set of block indices
-		stripesTouched := make(map[int64]map[int]bool)
-
-		for b := startBlock; b <= endBlock; b++ {
-			stripeID := b / totalBlocks
-			blockIdx := int(b % totalBlocks)
-
-			if _, ok := stripesTouched[stripeID]; !ok {
-				stripesTouched[stripeID] = make(map[int]bool)
-			}
-			stripesTouched[stripeID][blockIdx] = true
-		}
+// recordKeys 是一条记录所在的天/小时/分钟 key
+type recordKeys struct {
+	day, hour, minute string
+}
 
-		ag.stripeMu.Lock()
-		for stripeID, touchedBlocks := range stripesTouched {
-			if ioType == "1" {
-				count := len(touchedBlocks)
-				ag.stripeUpdateMap[count]++
-			}
-
-			// Heatmap update
-			// Get or create the counters for this stripe
-			counters, ok := ag.stripeBlockHeatMap[stripeID]
-			if !ok {
-				counters = make([]CountPair, int(totalBlocks))
-				ag.stripeBlockHeatMap[stripeID] = counters
-			}
-
-			// Update Blocks
-			for blockIdx := range touchedBlocks {
-				if blockIdx >= 0 && blockIdx < int(totalBlocks) {
-					if ioType == "0" {
-						counters[blockIdx].Reads++
-					} else {
-						counters[blockIdx].Writes++
-					}
-
-					// Record detailed stripe operation
-					bType := "Data"
-					if blockIdx >= ag.dataBlocks {
-						bType = "Parity"
-					}
-					rw := "Read"
-					if ioType == "1" {
-						rw = "Write"
-					}
-					ag.stripeOps = append(ag.stripeOps, StripeOperation{
-						StripeID:   stripeID,
-						BlockIndex: blockIdx,
-						BlockType:  bType,
-						ReadWrite:  rw,
-						OptionTime: ts,
-					})
-				}
-			}
-		}
-		ag.stripeMu.Unlock()
+func makeRecordKeys(ts time.Time) recordKeys {
+	return recordKeys{
+		day:    ts.Format("01-02"),
+		hour:   ts.Format("01-02 15"),
+		minute: ts.Format("01-02 15:04"),
 	}
+}
 
-	dayKey := ts.Format("01-02")
-	hourKey := ts.Format("01-02 15")
-	minuteKey := ts.Format("01-02 15:04")
-
-	// day
-	ag.dayMu.Lock()
-	cp, ok := ag.dayMap[dayKey]
-	if !ok {
-		cp = &CountPair{}
-		ag.dayMap[dayKey] = cp
-	}
-	if ioType == "0" {
-		cp.Reads++
-	} else {
-		cp.Writes++
-	}
-	ag.dayMu.Unlock()
-
-	// hour
-	ag.hourMu.Lock()
-	hcp, ok := ag.hourMap[hourKey]
-	if !ok {
-		hcp = &CountPair{}
-		ag.hourMap[hourKey] = hcp
-	}
-	if ioType == "0" {
-		hcp.Reads++
-	} else {
-		hcp.Writes++
-	}
-	ag.hourMu.Unlock()
-
-	// minute
-	ag.minuteMu.Lock()
-	mcp, ok := ag.minuteMap[minuteKey]
-	if !ok {
-		mcp = &CountPair{}
-		ag.minuteMap[minuteKey] = mcp
+// observeShared 把记录交给依赖记录顺序或全局状态的分析器，这些分析器不能按 worker 分片。
+// 绕开分片本身不保证顺序：parser worker 只在按批次序号通过 batchGate 后经 observeOrdered 调用这里
+func (ag *Aggregator) observeShared(rec *trace.IORecord, k *recordKeys) {
+	if ag.targets != nil {
+		for _, st := range ag.stripesFor(rec.Volume) {
+			st.observe(rec, k.minute)
+		}
 	}
-	if ioType == "0" {
-		mcp.Reads++
-	} else {
-		mcp.Writes++
+	if ag.seq != nil {
+		ag.seq.observe(rec)
 	}
-	ag.minuteMu.Unlock()
-
-	// minute-volume
-	if ag.enableMinuteVolume {
-		var evictedKey string
-		var evictedMap map[string]*CountPair
-		ag.minuteVolMu.Lock()
-		mv, ok := ag.minuteVolMap[minuteKey]
-		if !ok {
-			mv = make(map[string]*CountPair)
-			ag.minuteVolMap[minuteKey] = mv
-			ag.minuteOrder = append(ag.minuteOrder, minuteKey)
-		}
-		vmin, ok := mv[vol]
-		if !ok {
-			vmin = &CountPair{}
-			mv[vol] = vmin
-		}
-		if ioType == "0" {
-			vmin.Reads++
-		} else {
-			vmin.Writes++
-		}
-		if ag.minuteBufLimit > 0 && len(ag.minuteOrder) > ag.minuteBufLimit {
-			evictedKey = ag.minuteOrder[0]
-			evictedMap = ag.minuteVolMap[evictedKey]
-			delete(ag.minuteVolMap, evictedKey)
-			ag.minuteOrder = ag.minuteOrder[1:]
-		}
-		ag.minuteVolMu.Unlock()
-		if evictedMap != nil && ag.onEvict != nil {
-			ag.onEvict(evictedKey, evictedMap)
-		}
+	if ag.workingSet != nil {
+		ag.workingSet.observe(rec, k.minute, k.hour, k.day)
 	}
-
-	// volume
-	ag.volMu.Lock()
-	vp, ok := ag.volMap[vol]
-	if !ok {
-		vp = &CountPair{}
-		ag.volMap[vol] = vp
+	if ag.hot != nil {
+		ag.hot.observe(rec)
 	}
-	if ioType == "0" {
-		vp.Reads++
-	} else {
-		vp.Writes++
+	if ag.lbaHeat != nil {
+		ag.lbaHeat.observe(rec)
 	}
-	ag.volMu.Unlock()
 }
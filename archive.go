@@ -0,0 +1,236 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"ana/internal/lz4"
+	"ana/internal/xz"
+	"ana/internal/zstd"
+)
+
+// archiveFormat 是按魔数识别出的输入格式
+type archiveFormat int
+
+const (
+	formatPlain archiveFormat = iota
+	formatGzip
+	formatZstd
+	formatXz
+	formatBzip2
+	formatLz4
+	formatTar
+	formatZip
+)
+
+// sniffLen 是识别格式需要的文件头长度（tar 的 ustar 标记位于偏移 257）
+const sniffLen = 512
+
+// maxArchiveDepth 限制压缩/归档的嵌套层数，防止异常输入无限展开
+const maxArchiveDepth = 8
+
+// traceExts 是遍历输入目录时收集的扩展名，实际格式以文件头为准
+var traceExts = map[string]bool{
+	".csv": true, ".gz": true, ".tgz": true, ".zst": true, ".tzst": true,
+	".xz": true, ".txz": true, ".bz2": true, ".tbz2": true, ".lz4": true, ".zip": true, ".tar": true,
+}
+
+// isTraceFile 判断 path 的扩展名是否属于可处理的 trace 文件
+func isTraceFile(path string) bool {
+	return traceExts[strings.ToLower(filepath.Ext(path))]
+}
+
+func init() {
+	// 让 zip 成员也可以使用 bzip2(12)、zstd(93)、xz(95) 压缩方法
+	zip.RegisterDecompressor(12, func(r io.Reader) io.ReadCloser {
+		return io.NopCloser(bzip2.NewReader(r))
+	})
+	zip.RegisterDecompressor(93, func(r io.Reader) io.ReadCloser {
+		return io.NopCloser(zstd.NewReader(r))
+	})
+	zip.RegisterDecompressor(95, func(r io.Reader) io.ReadCloser {
+		zr, err := xz.NewReader(r)
+		if err != nil {
+			return io.NopCloser(errReader{err})
+		}
+		return io.NopCloser(zr)
+	})
+}
+
+type errReader struct{ err error }
+
+func (e errReader) Read([]byte) (int, error) { return 0, e.err }
+
+// sniffFormat 根据文件头的魔数判断格式，无法识别的按纯文本处理
+func sniffFormat(head []byte) archiveFormat {
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return formatGzip
+	case bytes.HasPrefix(head, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return formatZstd
+	case bytes.HasPrefix(head, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+		return formatXz
+	case len(head) >= 10 && bytes.HasPrefix(head, []byte("BZh")) && head[3] >= '1' && head[3] <= '9' &&
+		(bytes.Equal(head[4:10], []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}) || bytes.Equal(head[4:10], []byte{0x17, 0x72, 0x45, 0x38, 0x50, 0x90})):
+		return formatBzip2
+	case bytes.HasPrefix(head, []byte{0x04, 0x22, 0x4d, 0x18}), bytes.HasPrefix(head, []byte{0x02, 0x21, 0x4c, 0x18}):
+		return formatLz4
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return formatZip
+	case len(head) >= 262 && bytes.Equal(head[257:262], []byte("ustar")):
+		return formatTar
+	}
+	return formatPlain
+}
+
+// streamNested 识别 r 的格式：压缩流解压后继续识别，tar/zip 逐个成员处理，其余按文本行送往 out。
+// name 是用于行号定位的文件标识，归档成员以 "外层:成员名" 表示。
+// 解压或读取归档时的错误（损坏、截断）返回给调用方；纯文本文件自身的扫描错误只打印
+func streamNested(r io.Reader, name string, out batchSink, depth int) (uint64, error) {
+	if depth > maxArchiveDepth {
+		return 0, fmt.Errorf("%s: 压缩/归档嵌套超过 %d 层", name, maxArchiveDepth)
+	}
+	br := bufio.NewReaderSize(r, 64*1024)
+	head, err := br.Peek(sniffLen)
+	if err != nil && err != io.EOF && depth > 0 {
+		// 解压流的错误只报告一次，不能留给后续读取
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	var dec io.Reader
+	switch sniffFormat(head) {
+	case formatGzip:
+		gzr, err := gzip.NewReader(br)
+		if err != nil {
+			return 0, err
+		}
+		defer gzr.Close()
+		dec = gzr
+	case formatZstd:
+		dec = zstd.NewReader(br)
+	case formatXz:
+		xzr, err := xz.NewReader(br)
+		if err != nil {
+			return 0, err
+		}
+		dec = xzr
+	case formatBzip2:
+		dec = bzip2.NewReader(br)
+	case formatLz4:
+		dec = lz4.NewReader(br)
+	case formatTar:
+		return streamTar(tar.NewReader(br), name, out, depth+1)
+	case formatZip:
+		return streamZipStream(br, name, out, depth+1)
+	default:
+		n, err := streamBatches(br, name, out)
+		if err != nil && depth > 0 && err != errLineTooLong {
+			return n, fmt.Errorf("%s: %w", name, err)
+		}
+		if err != nil {
+			fmt.Printf("扫描文件 %s 错误: %v\n", name, err)
+		}
+		return n, nil
+	}
+	return streamNested(dec, name, out, depth+1)
+}
+
+// streamTar 依次处理 tar 中的普通文件。单个成员出错时打印并继续处理其余成员，
+// 结束后返回出错的成员数与第一个错误
+func streamTar(tr *tar.Reader, name string, out batchSink, depth int) (uint64, error) {
+	var n uint64
+	var errs memberErrors
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return n, errs.err(name)
+		}
+		if err != nil {
+			return n, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		fmt.Printf("正在处理 tar 内文件: %s (size=%d)\n", header.Name, header.Size)
+		cnt, err := streamNested(tr, name+":"+header.Name, out, depth)
+		n += cnt
+		if err != nil {
+			fmt.Printf("扫描文件 %s 错误: %v\n", header.Name, err)
+			errs.add(err)
+		}
+	}
+}
+
+// streamZip 依次处理 zip 中的文件。单个成员出错时打印并继续处理其余成员，
+// 结束后返回出错的成员数与第一个错误
+func streamZip(zr *zip.Reader, name string, out batchSink, depth int) (uint64, error) {
+	var n uint64
+	var errs memberErrors
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		fmt.Printf("正在处理 zip 内文件: %s (size=%d)\n", f.Name, f.UncompressedSize64)
+		rc, err := f.Open()
+		if err != nil {
+			fmt.Printf("扫描文件 %s 错误: %v\n", f.Name, err)
+			errs.add(err)
+			continue
+		}
+		cnt, err := streamNested(rc, name+":"+f.Name, out, depth)
+		rc.Close()
+		n += cnt
+		if err != nil {
+			fmt.Printf("扫描文件 %s 错误: %v\n", f.Name, err)
+			errs.add(err)
+		}
+	}
+	return n, errs.err(name)
+}
+
+// memberErrors 统计归档中出错的成员数，并保留第一个错误
+type memberErrors struct {
+	count int
+	first error
+}
+
+func (e *memberErrors) add(err error) {
+	if e.count == 0 {
+		e.first = err
+	}
+	e.count++
+}
+
+func (e *memberErrors) err(name string) error {
+	if e.count == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s: %d 个成员读取失败，第一个错误: %w", name, e.count, e.first)
+}
+
+// streamZipStream 处理嵌套在其他压缩流或归档中的 zip：zip 需要随机访问，先写入临时文件
+func streamZipStream(r io.Reader, name string, out batchSink, depth int) (uint64, error) {
+	tmp, err := os.CreateTemp("", "ana-zip-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		return 0, err
+	}
+	zr, err := zip.NewReader(tmp, size)
+	if err != nil {
+		return 0, err
+	}
+	return streamZip(zr, name, out, depth)
+}
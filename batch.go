@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// batchBytes 是每个批次的初始缓冲大小，单行超过时按需扩大（不超过 scannerMaxBytes）
+const batchBytes = 256 * 1024
+
+// lineBatch 是读取端送往 worker 的一批完整行，buf 以 '\n' 分隔（最后一行可以不带换行）。
+// worker 处理完后通过 putBatch 归还，缓冲在读取端复用。
+type lineBatch struct {
+	buf  []byte
+	file string
+	line uint64        // buf 中第一行在文件中的行号
+	src  *fileProgress // 批次所属的输入文件，不跟踪进度时为 nil
+	seq  uint64        // 批次的送出序号，决定记录进入顺序相关分析器的先后
+}
+
+// fileProgress 跟踪一个输入文件尚未聚合完的批次数：读取端开始时持有一份，每送出一个批次加一；
+// worker 把批次中的记录合并进全局聚合后减一，读取端读完文件后释放自己的一份。
+// 计数归零时该文件的记录已全部聚合，fileProgress 被送往 done 通道，由进度回调处理。
+type fileProgress struct {
+	path    string
+	lines   uint64 // 文件的非空行数，读取端读完后写入
+	pending atomic.Int64
+	done    chan<- *fileProgress
+}
+
+// newFileProgress 创建由读取端持有一份的进度跟踪；done 需有足够缓冲，避免 worker 在通知时阻塞
+func newFileProgress(path string, done chan<- *fileProgress) *fileProgress {
+	fp := &fileProgress{path: path, done: done}
+	fp.pending.Store(1)
+	return fp
+}
+
+// release 释放一份计数，最后一份释放时通知 done；nil 表示不跟踪
+func (fp *fileProgress) release() {
+	if fp != nil && fp.pending.Add(-1) == 0 {
+		fp.done <- fp
+	}
+}
+
+// batchSink 是读取端送出批次的目的地，并给每个批次标上所属的输入文件与送出序号
+type batchSink struct {
+	ch    chan<- *lineBatch
+	file  *fileProgress
+	order *batchOrder
+}
+
+func (s batchSink) send(b *lineBatch) {
+	if s.file != nil {
+		s.file.pending.Add(1)
+	}
+	b.src = s.file
+	s.order.mu.Lock()
+	b.seq = s.order.next
+	s.order.next++
+	s.ch <- b
+	s.order.mu.Unlock()
+}
+
+// batchOrder 给送往同一通道的批次编号。编号与入队在同一把锁内完成，通道中的序号严格递增：
+// worker 收到序号 n 时，更小的序号都已被其他 worker 取走，按序号等待 batchGate 不会死锁
+type batchOrder struct {
+	mu   sync.Mutex
+	next uint64
+}
+
+// batchGate 让 worker 按批次序号依次进入顺序相关的分析器（缓存模拟、reuse distance、顺序流检测、
+// working set、热点、条带模拟等），使多 worker 时这些分析器看到的记录顺序与单 worker 一致
+type batchGate struct {
+	mu   sync.Mutex
+	cond sync.Cond
+	next uint64
+}
+
+func newBatchGate() *batchGate {
+	g := &batchGate{}
+	g.cond.L = &g.mu
+	return g
+}
+
+// enter 阻塞到序号 seq 之前的批次都已 leave
+func (g *batchGate) enter(seq uint64) {
+	g.mu.Lock()
+	for g.next != seq {
+		g.cond.Wait()
+	}
+	g.mu.Unlock()
+}
+
+func (g *batchGate) leave() {
+	g.mu.Lock()
+	g.next++
+	g.mu.Unlock()
+	g.cond.Broadcast()
+}
+
+var batchPool = sync.Pool{
+	New: func() any { return &lineBatch{buf: make([]byte, 0, batchBytes)} },
+}
+
+func getBatch() *lineBatch {
+	b := batchPool.Get().(*lineBatch)
+	b.buf = b.buf[:0]
+	return b
+}
+
+func putBatch(b *lineBatch) {
+	b.src = nil
+	batchPool.Put(b)
+}
+
+// batchQueueSize 把按行计的 -queue_size 换算为批次通道容量（按平均 64 字节/行估算），至少每个 worker 两个批次
+func batchQueueSize(queueLines, workers int) int {
+	return max(queueLines*64/batchBytes, 2*workers)
+}
+
+var errLineTooLong = errors.New("line too long")
+
+// isBlank 判断一行是否只包含空白
+func isBlank(line []byte) bool {
+	for _, c := range line {
+		if c != ' ' && c != '\t' && c != '\r' && c != '\v' && c != '\f' {
+			return false
+		}
+	}
+	return true
+}
+
+// forEachLine 依次回调批次中的非空行及其行号，行尾的 '\r' 会被去掉（与 bufio.ScanLines 一致）
+func (b *lineBatch) forEachLine(fn func(line []byte, lineNo uint64)) {
+	data := b.buf
+	lineNo := b.line
+	for len(data) > 0 {
+		var line []byte
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			line, data = data, nil
+		}
+		if n := len(line); n > 0 && line[n-1] == '\r' {
+			line = line[:n-1]
+		}
+		if !isBlank(line) {
+			fn(line, lineNo)
+		}
+		lineNo++
+	}
+}
+
+// countLines 返回 buf 中的总行数与非空行数
+func countLines(buf []byte) (total, nonBlank uint64) {
+	for len(buf) > 0 {
+		var line []byte
+		if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+			line, buf = buf[:i], buf[i+1:]
+		} else {
+			line, buf = buf, nil
+		}
+		total++
+		if !isBlank(line) {
+			nonBlank++
+		}
+	}
+	return total, nonBlank
+}
+
+// streamBatches 把 r 按换行边界切成批次送往 out，返回非空行数。
+// 每个批次尽量装满缓冲，末尾不完整的行留到下一个批次。
+func streamBatches(r io.Reader, file string, out batchSink) (uint64, error) {
+	var n uint64
+	lineNo := uint64(1)
+	var carry []byte
+	for {
+		b := getBatch()
+		b.file, b.line = file, lineNo
+		b.buf = append(b.buf, carry...)
+		carry = carry[:0]
+
+		eof := false
+		for !eof {
+			if len(b.buf) == cap(b.buf) {
+				// 缓冲已满：有换行就发送，否则说明单行过长，扩大缓冲继续读
+				if bytes.IndexByte(b.buf, '\n') >= 0 {
+					break
+				}
+				if len(b.buf) >= scannerMaxBytes {
+					putBatch(b)
+					return n, errLineTooLong
+				}
+				grown := make([]byte, len(b.buf), min(2*cap(b.buf), scannerMaxBytes))
+				copy(grown, b.buf)
+				b.buf = grown
+			}
+			m, err := r.Read(b.buf[len(b.buf):cap(b.buf)])
+			b.buf = b.buf[:len(b.buf)+m]
+			if err == io.EOF {
+				eof = true
+			} else if err != nil {
+				putBatch(b)
+				return n, err
+			}
+		}
+
+		if !eof {
+			i := bytes.LastIndexByte(b.buf, '\n')
+			carry = append(carry, b.buf[i+1:]...)
+			b.buf = b.buf[:i+1]
+		}
+		total, nonBlank := countLines(b.buf)
+		lineNo += total
+		n += nonBlank
+		if nonBlank > 0 {
+			out.send(b)
+		} else {
+			putBatch(b)
+		}
+		if eof {
+			return n, nil
+		}
+	}
+}
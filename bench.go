@@ -0,0 +1,327 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ana/trace"
+)
+
+// benchChunk 是预先切好的一段合成数据
+type benchChunk struct {
+	data  []byte
+	line  uint64
+	lines int
+}
+
+// benchLines 生成 n 行指定 provider 格式的合成 trace，覆盖 vols 个卷，时间跨度约一小时，
+// 并按 batchBytes 切成与读取端相同大小的块
+func benchLines(provider string, n, vols int, seed int64) []benchChunk {
+	rng := rand.New(rand.NewSource(seed))
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.Local)
+	var chunks []benchChunk
+	cur := benchChunk{line: 1}
+	for i := 0; i < n; i++ {
+		ts := start.Add(time.Duration(i) * time.Hour / time.Duration(n))
+		vol := rng.Intn(vols)
+		read := rng.Intn(2) == 0
+		size := int64(512) << uint(rng.Intn(8))
+		offset := rng.Int63n(1<<30) &^ 511
+		var text string
+		switch strings.ToLower(provider) {
+		case "alicloud":
+			op := "W"
+			if read {
+				op = "R"
+			}
+			text = fmt.Sprintf("%d,%s,%d,%d,%d", vol, op, offset, size, ts.UnixMicro())
+		case "msrc":
+			op := "Write"
+			if read {
+				op = "Read"
+			}
+			// Windows filetime：自 1601-01-01 起的 100ns 计数
+			ft := ts.UnixNano()/100 + 116444736000000000
+			text = fmt.Sprintf("%d,host%d,%d,%s,%d,%d,%d", ft, vol/4, vol%4, op, offset, size, rng.Intn(100000))
+		default:
+			op := 1
+			if read {
+				op = 0
+			}
+			text = fmt.Sprintf("%d,%d,%d,%d,%d", ts.Unix(), offset/512, size/512, op, vol)
+		}
+		if len(cur.data)+len(text)+1 > batchBytes {
+			chunks = append(chunks, cur)
+			cur = benchChunk{line: uint64(i + 1)}
+		}
+		cur.data = append(append(cur.data, text...), '\n')
+		cur.lines++
+	}
+	if cur.lines > 0 {
+		chunks = append(chunks, cur)
+	}
+	return chunks
+}
+
+// lockedWorker 是不分片的对照组：每条记录直接在全局结构上加锁累加，不经过 batchGate，只用于比较吞吐
+func lockedWorker(batchCh <-chan *lineBatch, parser Parser, agg *Aggregator, totalParsed *uint64) {
+	for b := range batchCh {
+		b.forEachLine(func(line []byte, lineNo uint64) {
+			rec, err := parser.ParseBytes(line)
+			if err != nil {
+				return
+			}
+			rec.Source = trace.SourcePos{File: b.file, Line: lineNo}
+			lockedAdd(agg, &rec)
+			atomic.AddUint64(totalParsed, 1)
+		})
+		b.src.release()
+		putBatch(b)
+	}
+}
+
+// lockedAdd 是对照组的累加方式：每条记录直接在全局结构上加锁累加（分片之前的做法）
+func lockedAdd(ag *Aggregator, rec *trace.IORecord) {
+	ts := rec.Timestamp
+	vol := rec.Volume
+	size := rec.Length
+	isRead := rec.IsRead()
+	if !ag.accept(ts) {
+		return
+	}
+	if ag.cache != nil {
+		ag.cache.observe(rec)
+		return
+	}
+
+	keys := makeRecordKeys(ts)
+	dayKey, hourKey, minuteKey := keys.day, keys.hour, keys.minute
+	ag.observeShared(rec, &keys)
+	if rec.HasLatency {
+		ag.latency.observe(rec, minuteKey)
+	}
+	ag.ioSize.observe(rec, hourKey)
+
+	// day
+	ag.dayMu.Lock()
+	cp, ok := ag.dayMap[dayKey]
+	if !ok {
+		cp = &CountPair{}
+		ag.dayMap[dayKey] = cp
+	}
+	cp.add(isRead, size)
+	ag.dayMu.Unlock()
+
+	// hour
+	ag.hourMu.Lock()
+	hcp, ok := ag.hourMap[hourKey]
+	if !ok {
+		hcp = &CountPair{}
+		ag.hourMap[hourKey] = hcp
+	}
+	hcp.add(isRead, size)
+	ag.hourMu.Unlock()
+
+	// minute
+	ag.minuteMu.Lock()
+	mcp, ok := ag.minuteMap[minuteKey]
+	if !ok {
+		mcp = &CountPair{}
+		ag.minuteMap[minuteKey] = mcp
+	}
+	mcp.add(isRead, size)
+	ag.minuteMu.Unlock()
+
+	// minute-volume
+	if ag.enableMinuteVolume {
+		var evictedKey string
+		var evictedMap map[string]*CountPair
+		var again bool
+		ag.minuteVolMu.Lock()
+		mv, ok := ag.minuteVolMap[minuteKey]
+		if !ok {
+			mv = make(map[string]*CountPair)
+			ag.minuteVolMap[minuteKey] = mv
+			ag.minuteOrder = append(ag.minuteOrder, minuteKey)
+		}
+		vmin, ok := mv[vol]
+		if !ok {
+			vmin = &CountPair{}
+			mv[vol] = vmin
+		}
+		vmin.add(isRead, size)
+		if ag.minuteBufLimit > 0 && len(ag.minuteOrder) > ag.minuteBufLimit {
+			evictedKey = ag.minuteOrder[0]
+			evictedMap = ag.minuteVolMap[evictedKey]
+			again = ag.evictedMinutes[evictedKey]
+			ag.evictedMinutes[evictedKey] = true
+			delete(ag.minuteVolMap, evictedKey)
+			ag.minuteOrder = ag.minuteOrder[1:]
+		}
+		ag.minuteVolMu.Unlock()
+		if evictedMap != nil && ag.onEvict != nil {
+			ag.onEvict(evictedKey, evictedMap, again)
+		}
+	}
+
+	// volume
+	ag.volMu.Lock()
+	vp, ok := ag.volMap[vol]
+	if !ok {
+		vp = &CountPair{}
+		ag.volMap[vol] = vp
+	}
+	vp.add(isRead, size)
+	if ag.firstTs.IsZero() || ts.Before(ag.firstTs) {
+		ag.firstTs = ts
+	}
+	if ts.After(ag.lastTs) {
+		ag.lastTs = ts
+	}
+	ag.volMu.Unlock()
+}
+
+// csvParser 由各 provider 实现，暴露 encoding/csv 回退路径供对照
+type csvParser interface {
+	ParseCSV(line string) (trace.IORecord, error)
+}
+
+// benchParse 单线程只解析不累加，返回每条记录的耗时与分配次数。
+// path 为 bytes 时走 ParseBytes，为 csv 时把每行交给 encoding/csv 回退路径
+func benchParse(chunks []benchChunk, provider, path string) (nsPerRec, allocsPerRec float64, ok bool) {
+	p := newParser(provider)
+	cp, hasCSV := p.(csvParser)
+	if path == "csv" && !hasCSV {
+		return 0, 0, false
+	}
+	var before, after runtime.MemStats
+	var n int
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	begin := time.Now()
+	for _, c := range chunks {
+		b := lineBatch{buf: c.data, file: "bench", line: c.line}
+		b.forEachLine(func(line []byte, lineNo uint64) {
+			if path == "csv" {
+				cp.ParseCSV(string(line))
+			} else {
+				p.ParseBytes(line)
+			}
+			n++
+		})
+	}
+	elapsed := time.Since(begin)
+	runtime.ReadMemStats(&after)
+	if n == 0 {
+		return 0, 0, true
+	}
+	return float64(elapsed.Nanoseconds()) / float64(n), float64(after.Mallocs-before.Mallocs) / float64(n), true
+}
+
+// benchRun 用 workers 个 worker 处理 chunks，返回耗时（包含把数据拷入批次缓冲的读取端开销）
+func benchRun(chunks []benchChunk, provider string, workers int, mode string) time.Duration {
+	agg := NewAggregator()
+	batchCh := make(chan *lineBatch, 2*workers)
+	var parsed, failed uint64
+	var wg sync.WaitGroup
+	gate := newBatchGate()
+	begin := time.Now()
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p := newParser(provider)
+			if mode == "locked" {
+				lockedWorker(batchCh, p, agg, &parsed)
+			} else {
+				parserWorker(batchCh, p, agg, gate, &parsed, &failed)
+			}
+		}()
+	}
+	for i, c := range chunks {
+		b := getBatch()
+		b.buf = append(b.buf, c.data...)
+		b.file, b.line, b.seq = "bench", c.line, uint64(i)
+		batchCh <- b
+	}
+	close(batchCh)
+	wg.Wait()
+	return time.Since(begin)
+}
+
+// runBench 实现 `ana bench` 子命令：在合成数据上对比分片/加锁两种累加方式随 -w 的吞吐变化
+func runBench(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	n := fs.Int("n", 1000000, "合成记录条数")
+	vols := fs.Int("vols", 64, "合成数据的卷数")
+	provider := fs.String("provider", "tencent", "合成数据格式: alicloud|tencent|msrc，可逗号分隔多个")
+	workerList := fs.String("w", "", "逗号分隔的 worker 数列表，默认 1,2,4... 直到 numCPU")
+	modes := fs.String("mode", "sharded,locked", "累加方式: sharded(worker 本地分片)|locked(全局加锁)")
+	parseOnly := fs.Bool("parse", true, "先单独对各 provider 的解析器计时（零分配切分 vs encoding/csv）")
+	fs.Parse(args)
+
+	var workers []int
+	if *workerList == "" {
+		for w := 1; w < runtime.NumCPU(); w *= 2 {
+			workers = append(workers, w)
+		}
+		workers = append(workers, runtime.NumCPU())
+	} else {
+		for _, s := range splitList(*workerList) {
+			w, err := strconv.Atoi(s)
+			if err != nil || w <= 0 {
+				fmt.Printf("worker 数不正确: %s\n", s)
+				os.Exit(1)
+			}
+			workers = append(workers, w)
+		}
+	}
+
+	fmt.Printf("GOMAXPROCS=%d 记录数=%d 卷数=%d\n", runtime.GOMAXPROCS(0), *n, *vols)
+	chunks := make(map[string][]benchChunk)
+	for _, prov := range splitList(*provider) {
+		chunks[prov] = benchLines(prov, *n, *vols, 1)
+	}
+	if *parseOnly {
+		fmt.Printf("%-10s %-8s %10s %12s %14s %8s\n", "Provider", "Path", "ns/rec", "allocs/rec", "Records/s", "Speedup")
+		for _, prov := range splitList(*provider) {
+			var base float64
+			for _, path := range []string{"csv", "bytes"} {
+				ns, allocs, ok := benchParse(chunks[prov], prov, path)
+				if !ok {
+					continue
+				}
+				rate := 1e9 / ns
+				if base == 0 {
+					base = rate
+				}
+				fmt.Printf("%-10s %-8s %10.1f %12.2f %14.0f %7.2fx\n", prov, path, ns, allocs, rate, rate/base)
+			}
+		}
+		fmt.Println()
+	}
+	fmt.Printf("%-10s %-8s %8s %10s %14s %8s\n", "Provider", "Mode", "Workers", "Seconds", "Records/s", "Speedup")
+	for _, prov := range splitList(*provider) {
+		chunks := chunks[prov]
+		for _, mode := range splitList(*modes) {
+			var base float64
+			for _, w := range workers {
+				runtime.GC()
+				sec := benchRun(chunks, prov, w, mode).Seconds()
+				rate := float64(*n) / sec
+				if base == 0 {
+					base = rate
+				}
+				fmt.Printf("%-10s %-8s %8d %10.3f %14.0f %7.2fx\n", prov, mode, w, sec, rate, rate/base)
+			}
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package cachesim
+
+import "container/list"
+
+// ARC 自适应替换缓存 (Megiddo & Modha, FAST'03)。
+// T1/T2 为实际缓存的最近/频繁列表，B1/B2 为对应的幽灵列表。
+type ARC struct {
+	capacity       int
+	p              int
+	t1, t2, b1, b2 *list.List
+	where          map[uint64]*arcRef
+}
+
+type arcRef struct {
+	l *list.List
+	e *list.Element
+}
+
+func NewARC(capacity int) *ARC {
+	return &ARC{
+		capacity: capacity,
+		t1:       list.New(), t2: list.New(), b1: list.New(), b2: list.New(),
+		where: make(map[uint64]*arcRef),
+	}
+}
+
+func (c *ARC) Name() string { return "arc" }
+
+func (c *ARC) move(key uint64, ref *arcRef, to *list.List) {
+	ref.l.Remove(ref.e)
+	ref.l = to
+	ref.e = to.PushFront(key)
+}
+
+func (c *ARC) dropLRU(l *list.List) {
+	k := l.Remove(l.Back()).(uint64)
+	delete(c.where, k)
+}
+
+// replace 将 T1 或 T2 的 LRU 项移入对应幽灵列表
+func (c *ARC) replace(inB2 bool, evict func(uint64)) {
+	var from, to *list.List
+	if c.t1.Len() > 0 && (c.t1.Len() > c.p || (inB2 && c.t1.Len() == c.p)) {
+		from, to = c.t1, c.b1
+	} else if c.t2.Len() > 0 {
+		from, to = c.t2, c.b2
+	} else {
+		from, to = c.t1, c.b1
+	}
+	k := from.Back().Value.(uint64)
+	c.move(k, c.where[k], to)
+	evict(k)
+}
+
+func (c *ARC) Access(key uint64, evict func(uint64)) bool {
+	ref, ok := c.where[key]
+	if ok && (ref.l == c.t1 || ref.l == c.t2) {
+		c.move(key, ref, c.t2)
+		return true
+	}
+	if ok && ref.l == c.b1 {
+		delta := 1
+		if c.b1.Len() < c.b2.Len() {
+			delta = c.b2.Len() / c.b1.Len()
+		}
+		c.p = min(c.capacity, c.p+delta)
+		c.replace(false, evict)
+		c.move(key, ref, c.t2)
+		return false
+	}
+	if ok && ref.l == c.b2 {
+		delta := 1
+		if c.b2.Len() < c.b1.Len() {
+			delta = c.b1.Len() / c.b2.Len()
+		}
+		c.p = max(0, c.p-delta)
+		c.replace(true, evict)
+		c.move(key, ref, c.t2)
+		return false
+	}
+
+	// 完全未命中
+	l1 := c.t1.Len() + c.b1.Len()
+	total := l1 + c.t2.Len() + c.b2.Len()
+	if l1 == c.capacity {
+		if c.t1.Len() < c.capacity {
+			c.dropLRU(c.b1)
+			c.replace(false, evict)
+		} else {
+			k := c.t1.Back().Value.(uint64)
+			c.dropLRU(c.t1)
+			evict(k)
+		}
+	} else if l1 < c.capacity && total >= c.capacity {
+		if total == 2*c.capacity {
+			c.dropLRU(c.b2)
+		}
+		c.replace(false, evict)
+	}
+	c.where[key] = &arcRef{l: c.t1, e: c.t1.PushFront(key)}
+	return false
+}
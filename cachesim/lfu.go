@@ -0,0 +1,69 @@
+package cachesim
+
+import "container/heap"
+
+type lfuEntry struct {
+	key   uint64
+	freq  int64
+	tick  int64 // 最近访问序号，频率相同时淘汰最久未访问的
+	index int
+}
+
+type lfuHeap []*lfuEntry
+
+func (h lfuHeap) Len() int { return len(h) }
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].freq != h[j].freq {
+		return h[i].freq < h[j].freq
+	}
+	return h[i].tick < h[j].tick
+}
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *lfuHeap) Push(x any) {
+	e := x.(*lfuEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+func (h *lfuHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// LFU 最不经常使用，频率相同时按 LRU 淘汰
+type LFU struct {
+	capacity int
+	tick     int64
+	h        lfuHeap
+	items    map[uint64]*lfuEntry
+}
+
+func NewLFU(capacity int) *LFU {
+	return &LFU{capacity: capacity, items: make(map[uint64]*lfuEntry)}
+}
+
+func (c *LFU) Name() string { return "lfu" }
+
+func (c *LFU) Access(key uint64, evict func(uint64)) bool {
+	c.tick++
+	if e, ok := c.items[key]; ok {
+		e.freq++
+		e.tick = c.tick
+		heap.Fix(&c.h, e.index)
+		return true
+	}
+	if len(c.h) >= c.capacity {
+		victim := heap.Pop(&c.h).(*lfuEntry)
+		delete(c.items, victim.key)
+		evict(victim.key)
+	}
+	e := &lfuEntry{key: key, freq: 1, tick: c.tick}
+	heap.Push(&c.h, e)
+	c.items[key] = e
+	return false
+}
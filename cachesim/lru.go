@@ -0,0 +1,31 @@
+package cachesim
+
+import "container/list"
+
+// LRU 最近最少使用
+type LRU struct {
+	capacity int
+	ll       *list.List
+	items    map[uint64]*list.Element
+}
+
+func NewLRU(capacity int) *LRU {
+	return &LRU{capacity: capacity, ll: list.New(), items: make(map[uint64]*list.Element)}
+}
+
+func (c *LRU) Name() string { return "lru" }
+
+func (c *LRU) Access(key uint64, evict func(uint64)) bool {
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		return true
+	}
+	if c.ll.Len() >= c.capacity {
+		tail := c.ll.Back()
+		k := c.ll.Remove(tail).(uint64)
+		delete(c.items, k)
+		evict(k)
+	}
+	c.items[key] = c.ll.PushFront(key)
+	return false
+}
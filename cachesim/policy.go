@@ -0,0 +1,66 @@
+// Package cachesim 提供块缓存淘汰策略与多策略、多容量的单遍回放模拟器。
+package cachesim
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Policy 是缓存淘汰策略，容量以 block 数计。
+// Access 访问一个 key：命中返回 true；未命中时将其插入缓存，
+// 每个因此被淘汰的 key 都会回调 evict。
+type Policy interface {
+	Name() string
+	Access(key uint64, evict func(key uint64)) bool
+}
+
+// Factory 根据容量（block 数）创建策略实例
+type Factory func(capacity int) Policy
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register 注册一个策略，名称不区分大小写；重复注册会覆盖已有实现
+func Register(name string, f Factory) {
+	registryMu.Lock()
+	registry[strings.ToLower(name)] = f
+	registryMu.Unlock()
+}
+
+// New 按名称创建策略
+func New(name string, capacity int) (Policy, error) {
+	registryMu.RLock()
+	f, ok := registry[strings.ToLower(name)]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown cache policy %q (available: %s)", name, strings.Join(Names(), ","))
+	}
+	if capacity < 1 {
+		capacity = 1
+	}
+	return f(capacity), nil
+}
+
+// Names 返回已注册的策略名称
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for n := range registry {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	Register("lru", func(c int) Policy { return NewLRU(c) })
+	Register("lfu", func(c int) Policy { return NewLFU(c) })
+	Register("arc", func(c int) Policy { return NewARC(c) })
+	Register("s3fifo", func(c int) Policy { return NewS3FIFO(c) })
+	Register("2q", func(c int) Policy { return NewTwoQ(c) })
+}
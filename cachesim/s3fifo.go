@@ -0,0 +1,105 @@
+package cachesim
+
+import "container/list"
+
+// S3FIFO (Yang et al., SOSP'23)：小 FIFO 队列 S（10%）过滤一次性访问，
+// 主 FIFO 队列 M 使用 2 bit 访问频率做 lazy promotion，幽灵队列 G 记录被 S 淘汰的 key。
+type S3FIFO struct {
+	capacity int
+	smallCap int
+	small    *list.List
+	main     *list.List
+	ghost    *list.List
+	entries  map[uint64]*s3Entry
+	ghosts   map[uint64]*list.Element
+}
+
+type s3Entry struct {
+	freq   uint8
+	inMain bool
+	e      *list.Element
+}
+
+func NewS3FIFO(capacity int) *S3FIFO {
+	return &S3FIFO{
+		capacity: capacity,
+		smallCap: max(1, capacity/10),
+		small:    list.New(),
+		main:     list.New(),
+		ghost:    list.New(),
+		entries:  make(map[uint64]*s3Entry),
+		ghosts:   make(map[uint64]*list.Element),
+	}
+}
+
+func (c *S3FIFO) Name() string { return "s3fifo" }
+
+func (c *S3FIFO) Access(key uint64, evict func(uint64)) bool {
+	if ent, ok := c.entries[key]; ok {
+		if ent.freq < 3 {
+			ent.freq++
+		}
+		return true
+	}
+	for c.small.Len()+c.main.Len() >= c.capacity {
+		c.evictOne(evict)
+	}
+	if g, ok := c.ghosts[key]; ok {
+		c.ghost.Remove(g)
+		delete(c.ghosts, key)
+		c.entries[key] = &s3Entry{inMain: true, e: c.main.PushFront(key)}
+	} else {
+		c.entries[key] = &s3Entry{e: c.small.PushFront(key)}
+	}
+	return false
+}
+
+func (c *S3FIFO) evictOne(evict func(uint64)) {
+	if c.small.Len() >= c.smallCap || c.main.Len() == 0 {
+		c.evictSmall(evict)
+	} else {
+		c.evictMain(evict)
+	}
+}
+
+func (c *S3FIFO) evictSmall(evict func(uint64)) {
+	for c.small.Len() > 0 {
+		k := c.small.Remove(c.small.Back()).(uint64)
+		ent := c.entries[k]
+		if ent.freq > 1 {
+			// 被多次访问，晋升到主队列
+			ent.freq = 0
+			ent.inMain = true
+			ent.e = c.main.PushFront(k)
+			if c.main.Len() > c.capacity-c.smallCap {
+				c.evictMain(evict)
+			}
+			continue
+		}
+		delete(c.entries, k)
+		c.ghosts[k] = c.ghost.PushFront(k)
+		if c.ghost.Len() > c.capacity-c.smallCap {
+			g := c.ghost.Remove(c.ghost.Back()).(uint64)
+			delete(c.ghosts, g)
+		}
+		evict(k)
+		return
+	}
+}
+
+func (c *S3FIFO) evictMain(evict func(uint64)) {
+	for c.main.Len() > 0 {
+		tail := c.main.Back()
+		k := tail.Value.(uint64)
+		ent := c.entries[k]
+		if ent.freq > 0 {
+			ent.freq--
+			c.main.MoveToFront(tail)
+			continue
+		}
+		c.main.Remove(tail)
+		delete(c.entries, k)
+		evict(k)
+		return
+	}
+}
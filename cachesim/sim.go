@@ -0,0 +1,76 @@
+package cachesim
+
+// Counters 是一个时间桶内的模拟统计
+type Counters struct {
+	Accesses     int64 // block 访问次数
+	Hits         int64
+	Bytes        int64 // 访问涉及的字节数
+	HitBytes     int64
+	ReadMissByte int64 // 读未命中需从后端读取的字节数（按整 block 计）
+	WriteBytes   int64 // 写入请求的字节数，即 write-through 的后端写流量
+	WriteBack    int64 // write-back 模式下脏块淘汰产生的后端写流量
+}
+
+func (c *Counters) Add(o *Counters) {
+	c.Accesses += o.Accesses
+	c.Hits += o.Hits
+	c.Bytes += o.Bytes
+	c.HitBytes += o.HitBytes
+	c.ReadMissByte += o.ReadMissByte
+	c.WriteBytes += o.WriteBytes
+	c.WriteBack += o.WriteBack
+}
+
+// Instance 是一个 (策略, 容量) 组合的回放状态。
+// 写请求采用 write-allocate；write-back 需跟踪脏块，write-through 的后端写流量即写入字节数。
+type Instance struct {
+	Policy        Policy
+	CapacityBytes int64
+	blockSize     int64
+	dirty         map[uint64]struct{}
+	Buckets       map[string]*Counters
+	cur           *Counters
+}
+
+func NewInstance(p Policy, capacityBytes, blockSize int64) *Instance {
+	return &Instance{
+		Policy:        p,
+		CapacityBytes: capacityBytes,
+		blockSize:     blockSize,
+		dirty:         make(map[uint64]struct{}),
+		Buckets:       make(map[string]*Counters),
+	}
+}
+
+func (in *Instance) evict(key uint64) {
+	if _, ok := in.dirty[key]; ok {
+		delete(in.dirty, key)
+		in.cur.WriteBack += in.blockSize
+	}
+}
+
+// Access 回放一次 block 访问，bytes 为请求落在该 block 上的字节数
+func (in *Instance) Access(bucket string, key uint64, bytes int64, write bool) {
+	c, ok := in.Buckets[bucket]
+	if !ok {
+		c = &Counters{}
+		in.Buckets[bucket] = c
+	}
+	in.cur = c
+	hit := in.Policy.Access(key, in.evict)
+	c.Accesses++
+	c.Bytes += bytes
+	if hit {
+		c.Hits++
+		c.HitBytes += bytes
+	} else if !write {
+		c.ReadMissByte += in.blockSize
+	}
+	if write {
+		c.WriteBytes += bytes
+		in.dirty[key] = struct{}{}
+	}
+}
+
+// DirtyBytes 返回仍驻留在缓存中的脏数据量（回放结束时需要刷回）
+func (in *Instance) DirtyBytes() int64 { return int64(len(in.dirty)) * in.blockSize }
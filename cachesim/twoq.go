@@ -0,0 +1,63 @@
+package cachesim
+
+import "container/list"
+
+// TwoQ 完整版 2Q (Johnson & Shasha, VLDB'94)。
+// A1in 为新进入项的 FIFO（容量 25%），A1out 为其幽灵队列（50%），Am 为 LRU 主队列。
+type TwoQ struct {
+	capacity        int
+	kin, kout       int
+	a1in, a1out, am *list.List
+	where           map[uint64]*arcRef
+}
+
+func NewTwoQ(capacity int) *TwoQ {
+	return &TwoQ{
+		capacity: capacity,
+		kin:      max(1, capacity/4),
+		kout:     max(1, capacity/2),
+		a1in:     list.New(), a1out: list.New(), am: list.New(),
+		where: make(map[uint64]*arcRef),
+	}
+}
+
+func (c *TwoQ) Name() string { return "2q" }
+
+func (c *TwoQ) reclaim(evict func(uint64)) {
+	if c.a1in.Len()+c.am.Len() < c.capacity {
+		return
+	}
+	if c.a1in.Len() > c.kin || c.am.Len() == 0 {
+		k := c.a1in.Remove(c.a1in.Back()).(uint64)
+		c.where[k] = &arcRef{l: c.a1out, e: c.a1out.PushFront(k)}
+		evict(k)
+		if c.a1out.Len() > c.kout {
+			g := c.a1out.Remove(c.a1out.Back()).(uint64)
+			delete(c.where, g)
+		}
+		return
+	}
+	k := c.am.Remove(c.am.Back()).(uint64)
+	delete(c.where, k)
+	evict(k)
+}
+
+func (c *TwoQ) Access(key uint64, evict func(uint64)) bool {
+	ref, ok := c.where[key]
+	switch {
+	case ok && ref.l == c.am:
+		c.am.MoveToFront(ref.e)
+		return true
+	case ok && ref.l == c.a1in:
+		return true
+	case ok && ref.l == c.a1out:
+		c.a1out.Remove(ref.e)
+		delete(c.where, key)
+		c.reclaim(evict)
+		c.where[key] = &arcRef{l: c.am, e: c.am.PushFront(key)}
+		return false
+	}
+	c.reclaim(evict)
+	c.where[key] = &arcRef{l: c.a1in, e: c.a1in.PushFront(key)}
+	return false
+}
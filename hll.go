@@ -0,0 +1,62 @@
+package main
+
+import (
+	"math"
+	"math/bits"
+)
+
+// mix64 (splitmix64 finalizer) 将整数均匀打散为 64 位哈希
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// hyperLogLog 基数估计，precision=p 时使用 2^p 个寄存器，标准误差约 1.04/sqrt(2^p)
+type hyperLogLog struct {
+	p         uint8
+	registers []uint8
+}
+
+func newHyperLogLog(p uint8) *hyperLogLog {
+	return &hyperLogLog{p: p, registers: make([]uint8, 1<<p)}
+}
+
+func (h *hyperLogLog) addHash(x uint64) {
+	idx := x >> (64 - h.p)
+	w := x<<h.p | 1<<(h.p-1)
+	rank := uint8(bits.LeadingZeros64(w)) + 1
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+func (h *hyperLogLog) merge(o *hyperLogLog) {
+	for i, r := range o.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+}
+
+func (h *hyperLogLog) estimate() int64 {
+	m := float64(len(h.registers))
+	var sum float64
+	zeros := 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	e := alpha * m * m / sum
+	// 小基数时使用线性计数修正
+	if e <= 2.5*m && zeros > 0 {
+		e = m * math.Log(m/float64(zeros))
+	}
+	return int64(e + 0.5)
+}
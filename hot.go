@@ -0,0 +1,289 @@
+package main
+
+import (
+	"container/heap"
+	"hash/fnv"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"ana/trace"
+)
+
+// hotKey 标识一个卷内的条带或 block
+type hotKey struct {
+	vol string
+	id  int64
+}
+
+// ssItem 是 Space-Saving 的一个计数器；err 为接管该计数器时继承的最小值，真实值 ∈ [count-err, count]
+type ssItem struct {
+	key   hotKey
+	hash  uint64
+	count int64
+	err   int64
+	idx   int
+}
+
+// spaceSaving 用 k 个计数器跟踪 top-k（按 count 的最小堆），任一 key 的高估不超过 total/k
+type spaceSaving struct {
+	k     int
+	items []*ssItem
+	index map[hotKey]*ssItem
+	total int64
+}
+
+func newSpaceSaving(k int) *spaceSaving {
+	return &spaceSaving{k: k, index: make(map[hotKey]*ssItem, k)}
+}
+
+func (s *spaceSaving) Len() int           { return len(s.items) }
+func (s *spaceSaving) Less(i, j int) bool { return s.items[i].count < s.items[j].count }
+func (s *spaceSaving) Swap(i, j int) {
+	s.items[i], s.items[j] = s.items[j], s.items[i]
+	s.items[i].idx = i
+	s.items[j].idx = j
+}
+func (s *spaceSaving) Push(x any) {
+	it := x.(*ssItem)
+	it.idx = len(s.items)
+	s.items = append(s.items, it)
+}
+func (s *spaceSaving) Pop() any {
+	it := s.items[len(s.items)-1]
+	s.items = s.items[:len(s.items)-1]
+	return it
+}
+
+func (s *spaceSaving) add(key hotKey, hash uint64, w int64) {
+	if w <= 0 {
+		return
+	}
+	s.total += w
+	if it, ok := s.index[key]; ok {
+		it.count += w
+		heap.Fix(s, it.idx)
+		return
+	}
+	if len(s.items) < s.k {
+		it := &ssItem{key: key, hash: hash, count: w}
+		s.index[key] = it
+		heap.Push(s, it)
+		return
+	}
+	// 替换计数最小的 key
+	it := s.items[0]
+	delete(s.index, it.key)
+	it.key, it.hash = key, hash
+	it.err = it.count
+	it.count += w
+	s.index[key] = it
+	heap.Fix(s, 0)
+}
+
+// countMin 是 depth × width 的 Count-Min sketch，估计值 ≥ 真实值，
+// 以 1-e^-depth 的概率高估不超过 e/width × total
+type countMin struct {
+	width uint64
+	rows  [][]int64
+}
+
+func newCountMin(depth, width int) *countMin {
+	cm := &countMin{width: uint64(width), rows: make([][]int64, depth)}
+	for i := range cm.rows {
+		cm.rows[i] = make([]int64, width)
+	}
+	return cm
+}
+
+func (cm *countMin) add(hash uint64, w int64) {
+	for i, row := range cm.rows {
+		row[mix64(hash+uint64(i)*0x9e3779b97f4a7c15)%cm.width] += w
+	}
+}
+
+func (cm *countMin) estimate(hash uint64) int64 {
+	est := int64(math.MaxInt64)
+	for i, row := range cm.rows {
+		if v := row[mix64(hash+uint64(i)*0x9e3779b97f4a7c15)%cm.width]; v < est {
+			est = v
+		}
+	}
+	return est
+}
+
+// hotMetric 是一个指标的 top-k 跟踪器与 CMS
+type hotMetric struct {
+	ss *spaceSaving
+	cm *countMin
+}
+
+func (m *hotMetric) add(key hotKey, hash uint64, w int64) {
+	m.ss.add(key, hash, w)
+	m.cm.add(hash, w)
+}
+
+const (
+	hotReads = iota
+	hotWrites
+	hotBytes
+	hotMetrics
+)
+
+var hotMetricNames = [hotMetrics]string{"Reads", "Writes", "Bytes"}
+
+// hotStats 在所有卷上同时跟踪最热的条带与 block（按读次数、写次数、字节数），内存只与 k 和 CMS 宽度有关
+type hotStats struct {
+	mu         sync.Mutex
+	blockSize  int64
+	dataBlocks int64
+	cmsDepth   int
+	cmsWidth   int
+	volKey     map[string]uint64
+	stripes    [hotMetrics]*hotMetric
+	blocks     [hotMetrics]*hotMetric
+}
+
+func newHotStats(k int, blockSize int64, dataBlocks, cmsDepth, cmsWidth int) *hotStats {
+	hs := &hotStats{
+		blockSize:  blockSize,
+		dataBlocks: int64(dataBlocks),
+		cmsDepth:   cmsDepth,
+		cmsWidth:   cmsWidth,
+		volKey:     make(map[string]uint64),
+	}
+	for i := 0; i < hotMetrics; i++ {
+		hs.stripes[i] = &hotMetric{ss: newSpaceSaving(k), cm: newCountMin(cmsDepth, cmsWidth)}
+		hs.blocks[i] = &hotMetric{ss: newSpaceSaving(k), cm: newCountMin(cmsDepth, cmsWidth)}
+	}
+	return hs
+}
+
+// observe 以数据块为单位展开一次 IO：每个被触及的 block / 条带计一次读或写，字节数按实际覆盖计
+func (hs *hotStats) observe(rec *trace.IORecord) {
+	if rec.Length <= 0 {
+		return
+	}
+	metric := hotWrites
+	if rec.IsRead() {
+		metric = hotReads
+	}
+	startBlock, endBlock := blockRange(rec.Offset, rec.Length, hs.blockSize)
+	end := rec.Offset + rec.Length
+
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	vh, ok := hs.volKey[rec.Volume]
+	if !ok {
+		h := fnv.New64a()
+		h.Write([]byte(rec.Volume))
+		vh = h.Sum64()
+		hs.volKey[rec.Volume] = vh
+	}
+	curStripe := int64(-1)
+	var stripeBytes int64
+	flushStripe := func() {
+		if curStripe < 0 {
+			return
+		}
+		key := hotKey{rec.Volume, curStripe}
+		hash := blockKey(^vh, curStripe)
+		hs.stripes[metric].add(key, hash, 1)
+		hs.stripes[hotBytes].add(key, hash, stripeBytes)
+	}
+	for b := startBlock; b <= endBlock; b++ {
+		lo := max(rec.Offset, b*hs.blockSize)
+		hi := min(end, (b+1)*hs.blockSize)
+		key := hotKey{rec.Volume, b}
+		hash := blockKey(vh, b)
+		hs.blocks[metric].add(key, hash, 1)
+		hs.blocks[hotBytes].add(key, hash, hi-lo)
+
+		if s := b / hs.dataBlocks; s != curStripe {
+			flushStripe()
+			curStripe, stripeBytes = s, 0
+		}
+		stripeBytes += hi - lo
+	}
+	flushStripe()
+}
+
+func (hs *hotStats) topRows(metrics *[hotMetrics]*hotMetric) [][]string {
+	var rows [][]string
+	for m, hm := range metrics {
+		// 按 CMS 收紧后的上界排序，比单用 Space-Saving 计数更接近真实排名
+		items := append([]*ssItem(nil), hm.ss.items...)
+		upper := make(map[*ssItem]int64, len(items))
+		for _, it := range items {
+			upper[it] = min(it.count, hm.cm.estimate(it.hash))
+		}
+		sort.Slice(items, func(i, j int) bool {
+			if upper[items[i]] != upper[items[j]] {
+				return upper[items[i]] > upper[items[j]]
+			}
+			return items[i].count-items[i].err > items[j].count-items[j].err
+		})
+		for rank, it := range items {
+			rows = append(rows, []string{
+				hotMetricNames[m],
+				strconv.Itoa(rank + 1),
+				it.key.vol,
+				strconv.FormatInt(it.key.id, 10),
+				strconv.FormatInt(it.count, 10),
+				strconv.FormatInt(it.err, 10),
+				strconv.FormatInt(it.count-it.err, 10),
+				strconv.FormatInt(upper[it], 10),
+			})
+		}
+	}
+	return rows
+}
+
+func (hs *hotStats) boundRows(granularity string, metrics *[hotMetrics]*hotMetric) [][]string {
+	rows := make([][]string, 0, hotMetrics)
+	for m, hm := range metrics {
+		total := hm.ss.total
+		k := int64(hm.ss.k)
+		cmsBound := math.E / float64(hs.cmsWidth) * float64(total)
+		rows = append(rows, []string{
+			granularity,
+			hotMetricNames[m],
+			strconv.FormatInt(total, 10),
+			strconv.FormatInt(k, 10),
+			strconv.FormatInt((total+k-1)/k, 10),
+			strconv.Itoa(hs.cmsDepth),
+			strconv.Itoa(hs.cmsWidth),
+			strconv.FormatFloat(cmsBound, 'f', 1, 64),
+			strconv.FormatFloat(1-math.Exp(-float64(hs.cmsDepth)), 'f', 4, 64),
+		})
+	}
+	return rows
+}
+
+// writeHotCSVs 输出 hot_stripes.csv、hot_blocks.csv 与误差界 hot_topk_bounds.csv。
+// Count 为 Space-Saving 计数，真实值 ∈ [LowerBound, UpperBound]，UpperBound 取 Space-Saving 与 CMS 的较小者。
+func writeHotCSVs(outDir string, ag *Aggregator) error {
+	hs := ag.hot
+	if hs == nil {
+		return nil
+	}
+	hs.mu.Lock()
+	stripeRows := hs.topRows(&hs.stripes)
+	blockRows := hs.topRows(&hs.blocks)
+	bounds := append(hs.boundRows("Stripe", &hs.stripes), hs.boundRows("Block", &hs.blocks)...)
+	hs.mu.Unlock()
+
+	header := []string{"Metric", "Rank", "VolumeID", "StripeID", "Count", "Error", "LowerBound", "UpperBound"}
+	if err := writeCSV(filepath.Join(outDir, "hot_stripes.csv"), header, stripeRows); err != nil {
+		return err
+	}
+	header[3] = "Block"
+	if err := writeCSV(filepath.Join(outDir, "hot_blocks.csv"), header, blockRows); err != nil {
+		return err
+	}
+	return writeCSV(filepath.Join(outDir, "hot_topk_bounds.csv"),
+		[]string{"Granularity", "Metric", "StreamTotal", "K", "SpaceSavingMaxError", "CMSDepth", "CMSWidth", "CMSErrorBound", "CMSConfidence"},
+		bounds)
+}
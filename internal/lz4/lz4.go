@@ -0,0 +1,317 @@
+// Package lz4 实现 LZ4 frame 格式（以及 lz4 -l 产生的 legacy 格式）的解压，只依赖标准库。
+// 支持拼接的多个 frame、skippable frame、块校验与内容校验，不支持预置字典。
+package lz4
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	frameMagic     = 0x184D2204
+	legacyMagic    = 0x184C2102
+	skippableMagic = 0x184D2A50 // 低 4 位可为 0-F
+	legacyBlock    = 8 << 20
+	windowSize     = 64 << 10
+)
+
+var (
+	ErrCorrupt  = errors.New("lz4: corrupt input")
+	ErrChecksum = errors.New("lz4: checksum mismatch")
+)
+
+// Reader 按顺序解压 r 中的所有 frame
+type Reader struct {
+	r   *bufio.Reader
+	err error
+
+	// 当前 frame 的参数
+	inFrame     bool
+	legacy      bool
+	independent bool
+	blockSum    bool
+	contentSum  bool
+	blockMax    int
+	hash        xxh32
+
+	src []byte // 压缩块
+	buf []byte // 解压缓冲：依赖块模式下前部保留最近 64KB 作为窗口
+	out []byte // buf 中尚未被读走的部分
+}
+
+// NewReader 返回从 r 解压 LZ4 数据的 Reader
+func NewReader(r io.Reader) *Reader {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReaderSize(r, 64<<10)
+	}
+	return &Reader{r: br}
+}
+
+func (z *Reader) Read(p []byte) (int, error) {
+	for len(z.out) == 0 {
+		if z.err != nil {
+			return 0, z.err
+		}
+		z.err = z.next()
+	}
+	n := copy(p, z.out)
+	z.out = z.out[n:]
+	return n, nil
+}
+
+// next 解出下一个块到 z.out，frame 结束时读取下一个 frame 头
+func (z *Reader) next() error {
+	if !z.inFrame {
+		return z.readFrameHeader()
+	}
+	if z.legacy {
+		return z.readLegacyBlock()
+	}
+	var h [4]byte
+	if _, err := io.ReadFull(z.r, h[:]); err != nil {
+		return unexpected(err)
+	}
+	size := binary.LittleEndian.Uint32(h[:])
+	if size == 0 {
+		// EndMark
+		z.inFrame = false
+		if z.contentSum {
+			if _, err := io.ReadFull(z.r, h[:]); err != nil {
+				return unexpected(err)
+			}
+			if binary.LittleEndian.Uint32(h[:]) != z.hash.sum() {
+				return ErrChecksum
+			}
+		}
+		return nil
+	}
+	raw := size&0x80000000 != 0
+	size &^= 0x80000000
+	if int(size) > z.blockMax {
+		return ErrCorrupt
+	}
+	z.src = grow(z.src, int(size))
+	if _, err := io.ReadFull(z.r, z.src); err != nil {
+		return unexpected(err)
+	}
+	if z.blockSum {
+		if _, err := io.ReadFull(z.r, h[:]); err != nil {
+			return unexpected(err)
+		}
+		var bh xxh32
+		bh.reset()
+		bh.write(z.src)
+		if binary.LittleEndian.Uint32(h[:]) != bh.sum() {
+			return ErrChecksum
+		}
+	}
+	start := z.keepWindow()
+	if raw {
+		z.buf = append(z.buf, z.src...)
+	} else {
+		var err error
+		if z.buf, err = decodeBlock(z.buf, z.src, z.blockMax); err != nil {
+			return err
+		}
+	}
+	z.out = z.buf[start:]
+	if z.contentSum {
+		z.hash.write(z.out)
+	}
+	return nil
+}
+
+// keepWindow 在解下一个块前整理缓冲：独立块模式清空，依赖块模式只保留最近 64KB，返回新块的起点
+func (z *Reader) keepWindow() int {
+	if z.independent || z.legacy {
+		z.buf = z.buf[:0]
+		return 0
+	}
+	if n := len(z.buf); n > windowSize {
+		copy(z.buf, z.buf[n-windowSize:])
+		z.buf = z.buf[:windowSize]
+	}
+	return len(z.buf)
+}
+
+// readFrameHeader 读取 magic 与 frame 描述符，跳过 skippable frame
+func (z *Reader) readFrameHeader() error {
+	var h [4]byte
+	if _, err := io.ReadFull(z.r, h[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return ErrCorrupt
+		}
+		return err
+	}
+	magic := binary.LittleEndian.Uint32(h[:])
+	switch {
+	case magic == legacyMagic:
+		z.inFrame, z.legacy = true, true
+		z.blockMax = legacyBlock
+		z.buf = z.buf[:0]
+		return nil
+	case magic&0xFFFFFFF0 == skippableMagic:
+		if _, err := io.ReadFull(z.r, h[:]); err != nil {
+			return unexpected(err)
+		}
+		_, err := z.r.Discard(int(binary.LittleEndian.Uint32(h[:])))
+		return unexpected(err)
+	case magic != frameMagic:
+		return fmt.Errorf("lz4: invalid magic %#x", magic)
+	}
+
+	var desc [14]byte
+	if _, err := io.ReadFull(z.r, desc[:2]); err != nil {
+		return unexpected(err)
+	}
+	flg, bd := desc[0], desc[1]
+	if flg>>6 != 1 || flg&0x02 != 0 || bd&0x8F != 0 {
+		return ErrCorrupt
+	}
+	if flg&0x01 != 0 {
+		return errors.New("lz4: dictionary not supported")
+	}
+	n := 2
+	if flg&0x08 != 0 {
+		n += 8 // content size，不需要
+	}
+	if _, err := io.ReadFull(z.r, desc[2:n+1]); err != nil {
+		return unexpected(err)
+	}
+	var hh xxh32
+	hh.reset()
+	hh.write(desc[:n])
+	if byte(hh.sum()>>8) != desc[n] {
+		return ErrChecksum
+	}
+	bsID := bd >> 4 & 0x7
+	if bsID < 4 {
+		return ErrCorrupt
+	}
+	z.inFrame, z.legacy = true, false
+	z.independent = flg&0x20 != 0
+	z.blockSum = flg&0x10 != 0
+	z.contentSum = flg&0x04 != 0
+	z.blockMax = 1 << (8 + 2*bsID)
+	z.hash.reset()
+	z.buf = z.buf[:0]
+	return nil
+}
+
+// readLegacyBlock 读取 legacy 格式的一个块；遇到 EOF 或新的 magic 时 legacy frame 结束
+func (z *Reader) readLegacyBlock() error {
+	h, err := z.r.Peek(4)
+	if err == io.EOF && len(h) == 0 {
+		z.inFrame = false
+		return io.EOF
+	}
+	if err != nil {
+		return unexpected(err)
+	}
+	size := binary.LittleEndian.Uint32(h)
+	if size == legacyMagic || size == frameMagic || size&0xFFFFFFF0 == skippableMagic {
+		z.inFrame = false
+		return nil
+	}
+	z.r.Discard(4)
+	if int(size) > legacyBlock*2 {
+		return ErrCorrupt
+	}
+	z.src = grow(z.src, int(size))
+	if _, err := io.ReadFull(z.r, z.src); err != nil {
+		return unexpected(err)
+	}
+	z.buf = z.buf[:0]
+	if z.buf, err = decodeBlock(z.buf, z.src, legacyBlock); err != nil {
+		return err
+	}
+	z.out = z.buf
+	return nil
+}
+
+// decodeBlock 把一个 LZ4 块解压追加到 dst，dst 原有内容作为匹配窗口，新增数据不超过 max 字节
+func decodeBlock(dst, src []byte, max int) ([]byte, error) {
+	base := len(dst)
+	limit := base + max
+	for i := 0; i < len(src); {
+		token := src[i]
+		i++
+		lit := int(token >> 4)
+		if lit == 15 {
+			for {
+				if i >= len(src) {
+					return dst, ErrCorrupt
+				}
+				b := src[i]
+				i++
+				lit += int(b)
+				if b != 255 {
+					break
+				}
+			}
+		}
+		if lit > len(src)-i || len(dst)+lit > limit {
+			return dst, ErrCorrupt
+		}
+		dst = append(dst, src[i:i+lit]...)
+		i += lit
+		if i == len(src) {
+			// 最后一个序列只有字面量
+			return dst, nil
+		}
+		if i+2 > len(src) {
+			return dst, ErrCorrupt
+		}
+		offset := int(src[i]) | int(src[i+1])<<8
+		i += 2
+		mlen := int(token & 0xF)
+		if mlen == 15 {
+			for {
+				if i >= len(src) {
+					return dst, ErrCorrupt
+				}
+				b := src[i]
+				i++
+				mlen += int(b)
+				if b != 255 {
+					break
+				}
+			}
+		}
+		mlen += 4
+		if offset == 0 || offset > len(dst) || len(dst)+mlen > limit {
+			return dst, ErrCorrupt
+		}
+		from := len(dst) - offset
+		if offset >= mlen {
+			dst = append(dst, dst[from:from+mlen]...)
+			continue
+		}
+		// 重叠匹配：按 offset 长度分段复制
+		for mlen > 0 {
+			n := min(offset, mlen)
+			dst = append(dst, dst[from:from+n]...)
+			from += n
+			mlen -= n
+		}
+	}
+	return dst, ErrCorrupt
+}
+
+func grow(b []byte, n int) []byte {
+	if cap(b) < n {
+		return make([]byte, n)
+	}
+	return b[:n]
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return ErrCorrupt
+	}
+	return err
+}
@@ -0,0 +1,82 @@
+package lz4
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const (
+	prime1 uint32 = 2654435761
+	prime2 uint32 = 2246822519
+	prime3 uint32 = 3266489917
+	prime4 uint32 = 668265263
+	prime5 uint32 = 374761393
+)
+
+// xxh32 是种子为 0 的流式 XXH32，用于 frame 描述符、块与内容校验
+type xxh32 struct {
+	v     [4]uint32
+	total uint64
+	mem   [16]byte
+	n     int
+}
+
+func (h *xxh32) reset() {
+	p1 := prime1 // 变量运算按 uint32 回绕
+	h.v = [4]uint32{p1 + prime2, prime2, 0, -p1}
+	h.total, h.n = 0, 0
+}
+
+func round(acc, in uint32) uint32 {
+	return bits.RotateLeft32(acc+in*prime2, 13) * prime1
+}
+
+func (h *xxh32) write(p []byte) {
+	h.total += uint64(len(p))
+	if h.n > 0 {
+		c := copy(h.mem[h.n:], p)
+		h.n += c
+		p = p[c:]
+		if h.n < 16 {
+			return
+		}
+		h.stripe(h.mem[:])
+		h.n = 0
+	}
+	for len(p) >= 16 {
+		h.stripe(p[:16])
+		p = p[16:]
+	}
+	h.n = copy(h.mem[:], p)
+}
+
+func (h *xxh32) stripe(b []byte) {
+	h.v[0] = round(h.v[0], binary.LittleEndian.Uint32(b[0:]))
+	h.v[1] = round(h.v[1], binary.LittleEndian.Uint32(b[4:]))
+	h.v[2] = round(h.v[2], binary.LittleEndian.Uint32(b[8:]))
+	h.v[3] = round(h.v[3], binary.LittleEndian.Uint32(b[12:]))
+}
+
+func (h *xxh32) sum() uint32 {
+	var acc uint32
+	if h.total >= 16 {
+		acc = bits.RotateLeft32(h.v[0], 1) + bits.RotateLeft32(h.v[1], 7) +
+			bits.RotateLeft32(h.v[2], 12) + bits.RotateLeft32(h.v[3], 18)
+	} else {
+		acc = prime5
+	}
+	acc += uint32(h.total)
+	p := h.mem[:h.n]
+	for ; len(p) >= 4; p = p[4:] {
+		acc = bits.RotateLeft32(acc+binary.LittleEndian.Uint32(p)*prime3, 17) * prime4
+	}
+	for _, b := range p {
+		acc = bits.RotateLeft32(acc+uint32(b)*prime5, 11) * prime1
+	}
+	acc ^= acc >> 15
+	acc *= prime2
+	acc ^= acc >> 13
+	acc *= prime3
+	acc ^= acc >> 16
+	return acc
+}
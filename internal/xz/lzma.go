@@ -0,0 +1,396 @@
+package xz
+
+import "errors"
+
+// 以下为 LZMA2 解码器，结构参照 xz-embedded：每个 LZMA chunk 用独立的区间解码器，
+// 字典在 chunk 之间保留，chunk 控制字节决定是否重置状态、属性与字典。
+
+var errCorrupt = errors.New("xz: corrupt LZMA2 data")
+
+const (
+	numStates       = 12
+	posStatesMax    = 1 << 4
+	matchLenMin     = 2
+	lenLowSymbols   = 8
+	lenMidSymbols   = 8
+	lenHighSymbols  = 256
+	distStates      = 4
+	distSlots       = 64
+	distModelStart  = 4
+	distModelEnd    = 14
+	fullDistances   = 1 << (distModelEnd / 2)
+	alignBits       = 4
+	alignSize       = 1 << alignBits
+	literalCoderLen = 0x300
+	probInit        = 1 << 10
+)
+
+// rangeDecoder 在一个完整读入内存的 chunk 上做区间解码
+type rangeDecoder struct {
+	rng  uint32
+	code uint32
+	in   []byte
+	pos  int
+	bad  bool // 读越界，chunk 已损坏
+}
+
+func (rc *rangeDecoder) init(in []byte) bool {
+	if len(in) < 5 || in[0] != 0 {
+		return false
+	}
+	rc.in, rc.pos, rc.bad = in, 5, false
+	rc.rng = 0xFFFFFFFF
+	rc.code = uint32(in[1])<<24 | uint32(in[2])<<16 | uint32(in[3])<<8 | uint32(in[4])
+	return true
+}
+
+func (rc *rangeDecoder) normalize() {
+	if rc.rng < 1<<24 {
+		if rc.pos >= len(rc.in) {
+			rc.bad = true
+			return
+		}
+		rc.rng <<= 8
+		rc.code = rc.code<<8 | uint32(rc.in[rc.pos])
+		rc.pos++
+	}
+}
+
+func (rc *rangeDecoder) bit(p *uint16) uint32 {
+	rc.normalize()
+	bound := (rc.rng >> 11) * uint32(*p)
+	if rc.code < bound {
+		rc.rng = bound
+		*p += (1<<11 - *p) >> 5
+		return 0
+	}
+	rc.rng -= bound
+	rc.code -= bound
+	*p -= *p >> 5
+	return 1
+}
+
+// bittree 按高位在前解出 n 位
+func (rc *rangeDecoder) bittree(probs []uint16, n uint) uint32 {
+	sym := uint32(1)
+	for i := uint(0); i < n; i++ {
+		sym = sym<<1 | rc.bit(&probs[sym])
+	}
+	return sym - 1<<n
+}
+
+// bittreeReverse 按低位在前解出 n 位，使用 probs[off+1] 起的概率
+func (rc *rangeDecoder) bittreeReverse(probs []uint16, off int, n uint) uint32 {
+	sym, res := uint32(1), uint32(0)
+	for i := uint(0); i < n; i++ {
+		b := rc.bit(&probs[off+int(sym)])
+		sym = sym<<1 | b
+		res |= b << i
+	}
+	return res
+}
+
+func (rc *rangeDecoder) direct(n uint) uint32 {
+	var res uint32
+	for ; n > 0; n-- {
+		rc.normalize()
+		rc.rng >>= 1
+		rc.code -= rc.rng
+		t := 0 - (rc.code >> 31)
+		rc.code += rc.rng & t
+		res = res<<1 + t + 1
+	}
+	return res
+}
+
+type lenDecoder struct {
+	choice  uint16
+	choice2 uint16
+	low     [posStatesMax][lenLowSymbols]uint16
+	mid     [posStatesMax][lenMidSymbols]uint16
+	high    [lenHighSymbols]uint16
+}
+
+func (ld *lenDecoder) reset() {
+	ld.choice, ld.choice2 = probInit, probInit
+	for i := range ld.low {
+		fill(ld.low[i][:])
+		fill(ld.mid[i][:])
+	}
+	fill(ld.high[:])
+}
+
+func (ld *lenDecoder) decode(rc *rangeDecoder, posState uint32) uint32 {
+	if rc.bit(&ld.choice) == 0 {
+		return matchLenMin + rc.bittree(ld.low[posState][:], 3)
+	}
+	if rc.bit(&ld.choice2) == 0 {
+		return matchLenMin + lenLowSymbols + rc.bittree(ld.mid[posState][:], 3)
+	}
+	return matchLenMin + lenLowSymbols + lenMidSymbols + rc.bittree(ld.high[:], 8)
+}
+
+// lzmaState 是 LZMA 的概率模型与状态机
+type lzmaState struct {
+	lc, lp, pb uint32
+
+	state                  uint32
+	rep0, rep1, rep2, rep3 uint32
+
+	isMatch    [numStates][posStatesMax]uint16
+	isRep      [numStates]uint16
+	isRep0     [numStates]uint16
+	isRep1     [numStates]uint16
+	isRep2     [numStates]uint16
+	isRep0Long [numStates][posStatesMax]uint16
+	distSlot   [distStates][distSlots]uint16
+	distSpec   [fullDistances - distModelEnd]uint16
+	distAlign  [alignSize]uint16
+	matchLen   lenDecoder
+	repLen     lenDecoder
+	literal    []uint16
+}
+
+func fill(p []uint16) {
+	for i := range p {
+		p[i] = probInit
+	}
+}
+
+// setProps 解析 lc/lp/pb 属性字节，LZMA2 要求 lc+lp <= 4
+func (s *lzmaState) setProps(b byte) bool {
+	if b > (4*5+4)*9+8 {
+		return false
+	}
+	s.pb = uint32(b) / 45
+	s.lp = uint32(b) % 45 / 9
+	s.lc = uint32(b) % 9
+	return s.lc+s.lp <= 4
+}
+
+func (s *lzmaState) reset() {
+	s.state, s.rep0, s.rep1, s.rep2, s.rep3 = 0, 0, 0, 0, 0
+	for i := range s.isMatch {
+		fill(s.isMatch[i][:])
+		fill(s.isRep0Long[i][:])
+	}
+	fill(s.isRep[:])
+	fill(s.isRep0[:])
+	fill(s.isRep1[:])
+	fill(s.isRep2[:])
+	for i := range s.distSlot {
+		fill(s.distSlot[i][:])
+	}
+	fill(s.distSpec[:])
+	fill(s.distAlign[:])
+	s.matchLen.reset()
+	s.repLen.reset()
+	n := literalCoderLen << (s.lc + s.lp)
+	if cap(s.literal) < n {
+		s.literal = make([]uint16, n)
+	}
+	s.literal = s.literal[:n]
+	fill(s.literal)
+}
+
+// dictionary 是线性缓冲的滑动窗口：超过 2 倍字典大小时把最近 size 字节搬到开头
+type dictionary struct {
+	buf   []byte
+	size  int
+	total uint64 // 自上次字典重置以来的字节数，用于 pos_state
+}
+
+func (d *dictionary) reset() {
+	d.buf = d.buf[:0]
+	d.total = 0
+}
+
+// prepare 在写入 n 字节前确保不需要再搬移，返回本次写入的起点
+func (d *dictionary) prepare(n int) int {
+	if keep := d.size; len(d.buf) > keep && len(d.buf)+n > 2*keep {
+		copy(d.buf, d.buf[len(d.buf)-keep:])
+		d.buf = d.buf[:keep]
+	}
+	return len(d.buf)
+}
+
+// lzma2Decoder 逐个 chunk 解码 LZMA2 数据
+type lzma2Decoder struct {
+	lzma      lzmaState
+	dict      dictionary
+	rc        rangeDecoder
+	needDict  bool // 首个 chunk 必须重置字典
+	needProps bool // 首个 LZMA chunk 必须带属性
+	needState bool
+}
+
+func newLZMA2Decoder(dictSize int) *lzma2Decoder {
+	return &lzma2Decoder{dict: dictionary{size: dictSize}, needDict: true, needProps: true}
+}
+
+// decodeChunk 解码一个压缩的 LZMA chunk，输出 size 字节追加到字典并返回这部分数据
+func (d *lzma2Decoder) decodeChunk(in []byte, size int) ([]byte, error) {
+	if !d.rc.init(in) {
+		return nil, errCorrupt
+	}
+	s := &d.lzma
+	dict := &d.dict
+	start := dict.prepare(size)
+	end := start + size
+	if cap(dict.buf) < end {
+		nb := make([]byte, len(dict.buf), max(end, 2*cap(dict.buf)))
+		copy(nb, dict.buf)
+		dict.buf = nb
+	}
+	buf := dict.buf[:end]
+	pos := start
+	pbMask := uint32(1)<<s.pb - 1
+	lpMask := uint32(1)<<s.lp - 1
+	total := uint32(dict.total) - uint32(start) // pos + total 即为字典位置的低 32 位
+	rc := &d.rc
+
+	for pos < end {
+		posState := (uint32(pos) + total) & pbMask
+		if rc.bit(&s.isMatch[s.state][posState]) == 0 {
+			var prev uint32
+			if pos > 0 {
+				prev = uint32(buf[pos-1])
+			}
+			idx := (((uint32(pos)+total)&lpMask)<<s.lc + prev>>(8-s.lc)) * literalCoderLen
+			probs := s.literal[idx : idx+literalCoderLen]
+			sym := uint32(1)
+			if s.state < 7 {
+				for sym < 0x100 {
+					sym = sym<<1 | rc.bit(&probs[sym])
+				}
+			} else {
+				if int(s.rep0) >= pos {
+					return nil, errCorrupt
+				}
+				match := uint32(buf[pos-int(s.rep0)-1]) << 1
+				offset := uint32(0x100)
+				for sym < 0x100 {
+					mbit := match & offset
+					match <<= 1
+					if rc.bit(&probs[offset+mbit+sym]) == 1 {
+						sym = sym<<1 | 1
+						offset = mbit
+					} else {
+						sym <<= 1
+						offset &^= mbit
+					}
+				}
+			}
+			buf[pos] = byte(sym)
+			pos++
+			switch {
+			case s.state <= 3:
+				s.state = 0
+			case s.state <= 9:
+				s.state -= 3
+			default:
+				s.state -= 6
+			}
+			continue
+		}
+
+		var length uint32
+		if rc.bit(&s.isRep[s.state]) == 0 {
+			if s.state < 7 {
+				s.state = 7
+			} else {
+				s.state = 10
+			}
+			s.rep3, s.rep2, s.rep1 = s.rep2, s.rep1, s.rep0
+			length = s.matchLen.decode(rc, posState)
+			s.rep0 = s.decodeDist(rc, length)
+			if s.rep0 == 0xFFFFFFFF {
+				// LZMA2 chunk 内不允许结束标记
+				return nil, errCorrupt
+			}
+		} else {
+			if rc.bit(&s.isRep0[s.state]) == 0 {
+				if rc.bit(&s.isRep0Long[s.state][posState]) == 0 {
+					if s.state < 7 {
+						s.state = 9
+					} else {
+						s.state = 11
+					}
+					length = 1
+				}
+			} else {
+				var dist uint32
+				if rc.bit(&s.isRep1[s.state]) == 0 {
+					dist = s.rep1
+				} else {
+					if rc.bit(&s.isRep2[s.state]) == 0 {
+						dist = s.rep2
+					} else {
+						dist = s.rep3
+						s.rep3 = s.rep2
+					}
+					s.rep2 = s.rep1
+				}
+				s.rep1 = s.rep0
+				s.rep0 = dist
+			}
+			if length == 0 {
+				if s.state < 7 {
+					s.state = 8
+				} else {
+					s.state = 11
+				}
+				length = s.repLen.decode(rc, posState)
+			}
+		}
+
+		dist := int(s.rep0) + 1
+		if dist > pos || dist > dict.size || int(length) > end-pos {
+			return nil, errCorrupt
+		}
+		from := pos - dist
+		if dist >= int(length) {
+			copy(buf[pos:pos+int(length)], buf[from:])
+			pos += int(length)
+		} else {
+			for i := 0; i < int(length); i++ {
+				buf[pos] = buf[from+i]
+				pos++
+			}
+		}
+		if rc.bad {
+			return nil, errCorrupt
+		}
+	}
+	rc.normalize()
+	if rc.bad || rc.pos != len(rc.in) || rc.code != 0 {
+		return nil, errCorrupt
+	}
+	dict.buf = buf
+	dict.total += uint64(size)
+	return buf[start:], nil
+}
+
+// decodeDist 解出匹配距离（rep0 的新值）
+func (s *lzmaState) decodeDist(rc *rangeDecoder, length uint32) uint32 {
+	lenState := min(length-matchLenMin, distStates-1)
+	slot := rc.bittree(s.distSlot[lenState][:], 6)
+	if slot < distModelStart {
+		return slot
+	}
+	n := uint(slot>>1 - 1)
+	dist := (2 | slot&1) << n
+	if slot < distModelEnd {
+		return dist + rc.bittreeReverse(s.distSpec[:], int(dist)-int(slot)-1, n)
+	}
+	dist += rc.direct(n-alignBits) << alignBits
+	return dist + rc.bittreeReverse(s.distAlign[:], 0, alignBits)
+}
+
+// appendRaw 追加一个未压缩 chunk 并返回字典中的这部分数据
+func (d *lzma2Decoder) appendRaw(data []byte) []byte {
+	start := d.dict.prepare(len(data))
+	d.dict.buf = append(d.dict.buf, data...)
+	d.dict.total += uint64(len(data))
+	return d.dict.buf[start:]
+}
@@ -0,0 +1,386 @@
+// Package xz 实现 .xz 容器格式的解压，只依赖标准库。
+// 支持拼接的多个 stream 与 stream padding，校验 CRC32/CRC64/SHA-256；
+// 过滤器只支持 LZMA2（xz 命令行默认），BCJ/Delta 等过滤器会返回错误。
+package xz
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+)
+
+var (
+	headerMagic = []byte{0xFD, '7', 'z', 'X', 'Z', 0x00}
+	footerMagic = []byte{'Y', 'Z'}
+
+	ErrFormat   = errors.New("xz: invalid format")
+	ErrChecksum = errors.New("xz: checksum mismatch")
+
+	crc64Table = crc64.MakeTable(crc64.ECMA)
+)
+
+const filterLZMA2 = 0x21
+
+// checkSizes 是各校验类型 ID 对应的校验字段长度
+var checkSizes = [16]int{0, 4, 4, 4, 8, 8, 8, 16, 16, 16, 32, 32, 32, 64, 64, 64}
+
+// Reader 按顺序解压 r 中的所有 stream
+type Reader struct {
+	r   *countReader
+	err error
+
+	flags   [2]byte   // 当前 stream 的 flags
+	check   hash.Hash // 当前 block 的校验，nil 表示不校验
+	inBlock bool
+	hdrSize int64 // 当前 block 头长度
+	lz      *lzma2Decoder
+	chunk   []byte
+	out     []byte
+}
+
+// countReader 记录已读字节数，用于 block padding 对齐
+type countReader struct {
+	*bufio.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := io.ReadFull(c.Reader, p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countReader) ReadByte() (byte, error) {
+	b, err := c.Reader.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// NewReader 读取第一个 stream 头并返回 Reader
+func NewReader(r io.Reader) (*Reader, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReaderSize(r, 64<<10)
+	}
+	z := &Reader{r: &countReader{Reader: br}}
+	if err := z.readStreamHeader(); err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+func (z *Reader) Read(p []byte) (int, error) {
+	for len(z.out) == 0 {
+		if z.err != nil {
+			return 0, z.err
+		}
+		z.err = z.next()
+	}
+	n := copy(p, z.out)
+	z.out = z.out[n:]
+	return n, nil
+}
+
+func (z *Reader) readStreamHeader() error {
+	var h [12]byte
+	if _, err := z.r.Read(h[:]); err != nil {
+		return unexpected(err)
+	}
+	if !bytes.Equal(h[:6], headerMagic) {
+		return ErrFormat
+	}
+	if crc32.ChecksumIEEE(h[6:8]) != binary.LittleEndian.Uint32(h[8:]) {
+		return ErrChecksum
+	}
+	if h[6] != 0 || h[7] > 0x0F {
+		return ErrFormat
+	}
+	copy(z.flags[:], h[6:8])
+	return nil
+}
+
+// next 产生下一段输出：block 内解一个 LZMA2 chunk，block 之间读取 block 头或 index/footer
+func (z *Reader) next() error {
+	if z.inBlock {
+		return z.readChunk()
+	}
+	size, err := z.r.ReadByte()
+	if err != nil {
+		return unexpected(err)
+	}
+	if size == 0 {
+		return z.readIndexAndFooter()
+	}
+	return z.readBlockHeader(int(size)*4 + 4)
+}
+
+func (z *Reader) readBlockHeader(n int) error {
+	h := make([]byte, n)
+	h[0] = byte(n/4 - 1)
+	if _, err := z.r.Read(h[1:]); err != nil {
+		return unexpected(err)
+	}
+	if crc32.ChecksumIEEE(h[:n-4]) != binary.LittleEndian.Uint32(h[n-4:]) {
+		return ErrChecksum
+	}
+	flags := h[1]
+	if flags&0x3C != 0 {
+		return ErrFormat
+	}
+	br := bytes.NewReader(h[2 : n-4])
+	if flags&0x40 != 0 {
+		if _, err := binary.ReadUvarint(br); err != nil {
+			return ErrFormat
+		}
+	}
+	if flags&0x80 != 0 {
+		if _, err := binary.ReadUvarint(br); err != nil {
+			return ErrFormat
+		}
+	}
+	if flags&0x03 != 0 {
+		return errors.New("xz: only a single LZMA2 filter is supported")
+	}
+	id, err := binary.ReadUvarint(br)
+	if err != nil {
+		return ErrFormat
+	}
+	if id != filterLZMA2 {
+		return fmt.Errorf("xz: unsupported filter %#x", id)
+	}
+	propSize, err := binary.ReadUvarint(br)
+	if err != nil || propSize != 1 {
+		return ErrFormat
+	}
+	prop, err := br.ReadByte()
+	if err != nil || prop > 40 {
+		return ErrFormat
+	}
+	dictSize := uint64(0xFFFFFFFF)
+	if prop < 40 {
+		dictSize = uint64(2|prop&1) << (prop/2 + 11)
+	}
+	for br.Len() > 0 {
+		if b, _ := br.ReadByte(); b != 0 {
+			return ErrFormat
+		}
+	}
+
+	z.lz = newLZMA2Decoder(int(dictSize))
+	z.inBlock = true
+	z.hdrSize = int64(n)
+	z.r.n = 0
+	z.check = nil
+	switch z.flags[1] {
+	case 0x01:
+		z.check = crc32.NewIEEE()
+	case 0x04:
+		z.check = crc64.New(crc64Table)
+	case 0x0A:
+		z.check = sha256.New()
+	}
+	return nil
+}
+
+// readChunk 解一个 LZMA2 chunk；遇到结束控制字节时读取 block padding 与校验
+func (z *Reader) readChunk() error {
+	ctrl, err := z.r.ReadByte()
+	if err != nil {
+		return unexpected(err)
+	}
+	lz := z.lz
+	if ctrl == 0x00 {
+		return z.finishBlock()
+	}
+	var h [5]byte
+	if ctrl == 0x01 || ctrl == 0x02 {
+		// 未压缩 chunk，0x01 同时重置字典
+		if ctrl == 0x01 {
+			lz.dict.reset()
+			lz.needDict = false
+		} else if lz.needDict {
+			return ErrFormat
+		}
+		if _, err := z.r.Read(h[:2]); err != nil {
+			return unexpected(err)
+		}
+		size := int(binary.BigEndian.Uint16(h[:2])) + 1
+		z.chunk = grow(z.chunk, size)
+		if _, err := z.r.Read(z.chunk); err != nil {
+			return unexpected(err)
+		}
+		return z.emit(lz.appendRaw(z.chunk))
+	}
+	if ctrl < 0x80 {
+		return ErrFormat
+	}
+
+	n := 4
+	reset := ctrl >> 5 & 0x3
+	if reset >= 2 {
+		n = 5
+	}
+	if _, err := z.r.Read(h[:n]); err != nil {
+		return unexpected(err)
+	}
+	usize := int(ctrl&0x1F)<<16 + int(binary.BigEndian.Uint16(h[:2])) + 1
+	csize := int(binary.BigEndian.Uint16(h[2:4])) + 1
+	switch {
+	case reset == 3:
+		lz.dict.reset()
+		lz.needDict = false
+	case lz.needDict:
+		return ErrFormat
+	}
+	if reset >= 2 {
+		if !lz.lzma.setProps(h[4]) {
+			return ErrFormat
+		}
+		lz.needProps = false
+	} else if lz.needProps {
+		return ErrFormat
+	}
+	if reset >= 1 {
+		lz.lzma.reset()
+	}
+	z.chunk = grow(z.chunk, csize)
+	if _, err := z.r.Read(z.chunk); err != nil {
+		return unexpected(err)
+	}
+	data, err := lz.decodeChunk(z.chunk, usize)
+	if err != nil {
+		return err
+	}
+	return z.emit(data)
+}
+
+func (z *Reader) emit(data []byte) error {
+	if z.check != nil {
+		z.check.Write(data)
+	}
+	z.out = data
+	return nil
+}
+
+// finishBlock 读取 block padding（补齐到 4 字节）并核对校验值
+func (z *Reader) finishBlock() error {
+	z.inBlock = false
+	if pad := int((4 - (z.hdrSize+z.r.n)%4) % 4); pad > 0 {
+		var p [3]byte
+		if _, err := z.r.Read(p[:pad]); err != nil {
+			return unexpected(err)
+		}
+		if p != [3]byte{} {
+			return ErrFormat
+		}
+	}
+	sum := make([]byte, checkSizes[z.flags[1]])
+	if _, err := z.r.Read(sum); err != nil {
+		return unexpected(err)
+	}
+	if z.check != nil && !bytes.Equal(z.check.Sum(nil), reverseIfCRC(sum, z.flags[1])) {
+		return ErrChecksum
+	}
+	return nil
+}
+
+// reverseIfCRC 把小端存储的 CRC32/CRC64 转成 hash.Sum 的大端字节序
+func reverseIfCRC(b []byte, check byte) []byte {
+	if check != 0x01 && check != 0x04 {
+		return b
+	}
+	r := make([]byte, len(b))
+	for i := range b {
+		r[i] = b[len(b)-1-i]
+	}
+	return r
+}
+
+// readIndexAndFooter 跳过 index、核对 stream footer，然后跳过 stream padding 并读取下一个 stream 头
+func (z *Reader) readIndexAndFooter() error {
+	crc := crc32.NewIEEE()
+	crc.Write([]byte{0})
+	z.r.n = 1
+	tr := &teeByteReader{r: z.r, h: crc}
+	count, err := binary.ReadUvarint(tr)
+	if err != nil {
+		return ErrFormat
+	}
+	for i := uint64(0); i < 2*count; i++ {
+		if _, err := binary.ReadUvarint(tr); err != nil {
+			return ErrFormat
+		}
+	}
+	for z.r.n%4 != 0 {
+		if b, err := tr.ReadByte(); err != nil || b != 0 {
+			return ErrFormat
+		}
+	}
+	var f [16]byte
+	if _, err := z.r.Read(f[:]); err != nil {
+		return unexpected(err)
+	}
+	if binary.LittleEndian.Uint32(f[:4]) != crc.Sum32() {
+		return ErrChecksum
+	}
+	foot := f[4:]
+	if crc32.ChecksumIEEE(foot[4:10]) != binary.LittleEndian.Uint32(foot[:4]) {
+		return ErrChecksum
+	}
+	if !bytes.Equal(foot[8:10], z.flags[:]) || !bytes.Equal(foot[10:], footerMagic) {
+		return ErrFormat
+	}
+
+	// stream padding 由 4 字节一组的 0 组成，之后是下一个 stream 或文件尾
+	for {
+		p, err := z.r.Peek(4)
+		if len(p) == 0 && err == io.EOF {
+			return io.EOF
+		}
+		if len(p) < 4 {
+			return ErrFormat
+		}
+		if !bytes.Equal(p, []byte{0, 0, 0, 0}) {
+			break
+		}
+		z.r.Discard(4)
+	}
+	return z.readStreamHeader()
+}
+
+// teeByteReader 逐字节读取并同时计入 index 的 CRC32
+type teeByteReader struct {
+	r *countReader
+	h hash.Hash32
+}
+
+func (t *teeByteReader) ReadByte() (byte, error) {
+	b, err := t.r.ReadByte()
+	if err == nil {
+		t.h.Write([]byte{b})
+	}
+	return b, err
+}
+
+func grow(b []byte, n int) []byte {
+	if cap(b) < n {
+		return make([]byte, n)
+	}
+	return b[:n]
+}
+
+func unexpected(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrFormat
+	}
+	return err
+}
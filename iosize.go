@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"math/bits"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"ana/trace"
+)
+
+// IO 大小按 2 的幂分桶: 512B, 1K, 2K ... 64M, 64M+
+const (
+	ioSizeMinShift = 9  // 512B
+	ioSizeMaxShift = 26 // 64M
+	ioSizeBuckets  = ioSizeMaxShift - ioSizeMinShift + 2
+)
+
+func ioSizeBucket(size int64) int {
+	if size <= 1<<ioSizeMinShift {
+		return 0
+	}
+	if size > 1<<ioSizeMaxShift {
+		return ioSizeBuckets - 1
+	}
+	return bits.Len64(uint64(size-1)) - ioSizeMinShift
+}
+
+func ioSizeBucketLabel(idx int) string {
+	if idx >= ioSizeBuckets-1 {
+		return "64M+"
+	}
+	shift := idx + ioSizeMinShift
+	switch {
+	case shift < 10:
+		return fmt.Sprintf("%dB", 1<<shift)
+	case shift < 20:
+		return fmt.Sprintf("%dK", 1<<(shift-10))
+	default:
+		return fmt.Sprintf("%dM", 1<<(shift-20))
+	}
+}
+
+// sizeHist 按读写分开的 IO 大小直方图
+type sizeHist [2][ioSizeBuckets]int64
+
+func (h *sizeHist) add(op trace.OpKind, size int64) { h[op][ioSizeBucket(size)]++ }
+func (h *sizeHist) merge(o *sizeHist) {
+	for op := range h {
+		for b := range h[op] {
+			h[op][b] += o[op][b]
+		}
+	}
+}
+
+// ioSizeStats 统计全局、按卷、按小时的 IO 大小分布
+type ioSizeStats struct {
+	mu      sync.Mutex
+	global  sizeHist
+	bytes   [2][ioSizeBuckets]int64
+	volMap  map[string]*sizeHist
+	hourMap map[string]*sizeHist
+}
+
+func newIOSizeStats() *ioSizeStats {
+	return &ioSizeStats{
+		volMap:  make(map[string]*sizeHist),
+		hourMap: make(map[string]*sizeHist),
+	}
+}
+
+func (st *ioSizeStats) observe(rec *trace.IORecord, hourKey string) {
+	b := ioSizeBucket(rec.Length)
+	st.mu.Lock()
+	st.global[rec.Op][b]++
+	st.bytes[rec.Op][b] += rec.Length
+	vh, ok := st.volMap[rec.Volume]
+	if !ok {
+		vh = &sizeHist{}
+		st.volMap[rec.Volume] = vh
+	}
+	vh[rec.Op][b]++
+	hh, ok := st.hourMap[hourKey]
+	if !ok {
+		hh = &sizeHist{}
+		st.hourMap[hourKey] = hh
+	}
+	hh[rec.Op][b]++
+	st.mu.Unlock()
+}
+
+// merge 把 o（worker 本地的统计）合并进来，o 中的对象在合并后归 st 所有
+func (st *ioSizeStats) merge(o *ioSizeStats) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.global.merge(&o.global)
+	for op := range st.bytes {
+		for b := range st.bytes[op] {
+			st.bytes[op][b] += o.bytes[op][b]
+		}
+	}
+	mergeSizeHistMap(st.volMap, o.volMap)
+	mergeSizeHistMap(st.hourMap, o.hourMap)
+}
+
+func mergeSizeHistMap(dst, src map[string]*sizeHist) {
+	for k, v := range src {
+		if d, ok := dst[k]; ok {
+			d.merge(v)
+		} else {
+			dst[k] = v
+		}
+	}
+}
+
+func ioSizeHistHeader(keyHeader string) []string {
+	header := []string{keyHeader, "Op"}
+	for i := 0; i < ioSizeBuckets; i++ {
+		header = append(header, ioSizeBucketLabel(i))
+	}
+	return header
+}
+
+// sizeHistRows 每个 key 输出 Read/Write 两行，列为各大小桶的计数
+func sizeHistRows(m map[string]*sizeHist) [][]string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	rows := make([][]string, 0, 2*len(keys))
+	for _, k := range keys {
+		h := m[k]
+		for op := trace.OpRead; op <= trace.OpWrite; op++ {
+			row := []string{k, op.String()}
+			for _, c := range h[op] {
+				row = append(row, strconv.FormatInt(c, 10))
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// writeIOSizeHistCSVs 输出 io_size_hist.csv / io_size_hist_volume.csv / io_size_hist_hour.csv
+func writeIOSizeHistCSVs(outDir string, ag *Aggregator) error {
+	st := ag.ioSize
+	st.mu.Lock()
+	global := st.global
+	bytes := st.bytes
+	volSnap := make(map[string]*sizeHist, len(st.volMap))
+	for k, v := range st.volMap {
+		c := *v
+		volSnap[k] = &c
+	}
+	hourSnap := make(map[string]*sizeHist, len(st.hourMap))
+	for k, v := range st.hourMap {
+		c := *v
+		hourSnap[k] = &c
+	}
+	st.mu.Unlock()
+
+	var totalReads, totalWrites int64
+	for i := 0; i < ioSizeBuckets; i++ {
+		totalReads += global[trace.OpRead][i]
+		totalWrites += global[trace.OpWrite][i]
+	}
+	header := []string{"IOSize", "Reads", "Writes", "ReadBytes", "WriteBytes", "Read(%)", "Write(%)"}
+	rows := make([][]string, 0, ioSizeBuckets)
+	for i := 0; i < ioSizeBuckets; i++ {
+		r, w := global[trace.OpRead][i], global[trace.OpWrite][i]
+		rows = append(rows, []string{
+			ioSizeBucketLabel(i),
+			strconv.FormatInt(r, 10),
+			strconv.FormatInt(w, 10),
+			strconv.FormatInt(bytes[trace.OpRead][i], 10),
+			strconv.FormatInt(bytes[trace.OpWrite][i], 10),
+			calculateReadRatioPercent(r, totalReads),
+			calculateReadRatioPercent(w, totalWrites),
+		})
+	}
+	if err := writeCSV(filepath.Join(outDir, "io_size_hist.csv"), header, rows); err != nil {
+		return err
+	}
+	if err := writeCSV(filepath.Join(outDir, "io_size_hist_volume.csv"), ioSizeHistHeader("VolumeID"), sizeHistRows(volSnap)); err != nil {
+		return err
+	}
+	return writeCSV(filepath.Join(outDir, "io_size_hist_hour.csv"), ioSizeHistHeader("Hour"), sizeHistRows(hourSnap))
+}
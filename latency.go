@@ -0,0 +1,256 @@
+package main
+
+import (
+	"math/bits"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"ana/trace"
+)
+
+// latencyHist 是对数-线性分桶的延迟直方图（单位 ns）。
+// 每个 2 的幂区间再细分 latencySubBuckets 个桶，相对误差约 6%，可直接相加合并。
+type latencyHist struct {
+	counts []int64
+	n      int64
+	sum    int64
+	max    int64
+}
+
+const (
+	latencySubBits    = 4
+	latencySubBuckets = 1 << latencySubBits
+)
+
+func latencyBucket(v int64) int {
+	if v < 2*latencySubBuckets {
+		if v < 0 {
+			return 0
+		}
+		return int(v)
+	}
+	sh := bits.Len64(uint64(v)) - latencySubBits - 1
+	return sh*latencySubBuckets + int(v>>uint(sh))
+}
+
+// latencyBucketValue 返回桶的代表值（区间中点）
+func latencyBucketValue(idx int) int64 {
+	if idx < 2*latencySubBuckets {
+		return int64(idx)
+	}
+	sh := idx/latencySubBuckets - 1
+	m := int64(idx - sh*latencySubBuckets)
+	lo := m << uint(sh)
+	hi := (m + 1) << uint(sh)
+	return lo + (hi-lo)/2
+}
+
+func (h *latencyHist) add(v int64) {
+	idx := latencyBucket(v)
+	if idx >= len(h.counts) {
+		grown := make([]int64, idx+1)
+		copy(grown, h.counts)
+		h.counts = grown
+	}
+	h.counts[idx]++
+	h.n++
+	h.sum += v
+	if v > h.max {
+		h.max = v
+	}
+}
+
+func (h *latencyHist) merge(o *latencyHist) {
+	if len(o.counts) > len(h.counts) {
+		grown := make([]int64, len(o.counts))
+		copy(grown, h.counts)
+		h.counts = grown
+	}
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+	h.n += o.n
+	h.sum += o.sum
+	if o.max > h.max {
+		h.max = o.max
+	}
+}
+
+func (h *latencyHist) clone() *latencyHist {
+	c := *h
+	c.counts = append([]int64(nil), h.counts...)
+	return &c
+}
+
+// quantile 返回第 q 分位的近似值
+func (h *latencyHist) quantile(q float64) int64 {
+	if h.n == 0 {
+		return 0
+	}
+	rank := int64(q*float64(h.n) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	var acc int64
+	for i, c := range h.counts {
+		acc += c
+		if acc >= rank {
+			v := latencyBucketValue(i)
+			if v > h.max {
+				v = h.max
+			}
+			return v
+		}
+	}
+	return h.max
+}
+
+// 读写分开的一对直方图
+type latencyPair [2]latencyHist
+
+func (lp *latencyPair) add(op trace.OpKind, v int64) { lp[op].add(v) }
+func (lp *latencyPair) merge(o *latencyPair) {
+	lp[0].merge(&o[0])
+	lp[1].merge(&o[1])
+}
+
+// latencyStats 按卷、按分钟、按 IO 大小统计延迟分布
+type latencyStats struct {
+	mu        sync.Mutex
+	samples   int64
+	volMap    map[string]*latencyPair
+	minuteMap map[string]*latencyPair
+	sizeHist  [ioSizeBuckets]latencyPair
+}
+
+func newLatencyStats() *latencyStats {
+	return &latencyStats{
+		volMap:    make(map[string]*latencyPair),
+		minuteMap: make(map[string]*latencyPair),
+	}
+}
+
+func (ls *latencyStats) observe(rec *trace.IORecord, minuteKey string) {
+	v := int64(rec.Latency)
+	ls.mu.Lock()
+	ls.samples++
+	vp, ok := ls.volMap[rec.Volume]
+	if !ok {
+		vp = &latencyPair{}
+		ls.volMap[rec.Volume] = vp
+	}
+	vp.add(rec.Op, v)
+	mp, ok := ls.minuteMap[minuteKey]
+	if !ok {
+		mp = &latencyPair{}
+		ls.minuteMap[minuteKey] = mp
+	}
+	mp.add(rec.Op, v)
+	ls.sizeHist[ioSizeBucket(rec.Length)].add(rec.Op, v)
+	ls.mu.Unlock()
+}
+
+// merge 把 o（worker 本地的统计）合并进来，o 中的对象在合并后归 ls 所有
+func (ls *latencyStats) merge(o *latencyStats) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.samples += o.samples
+	mergeLatencyMap(ls.volMap, o.volMap)
+	mergeLatencyMap(ls.minuteMap, o.minuteMap)
+	for i := range ls.sizeHist {
+		ls.sizeHist[i].merge(&o.sizeHist[i])
+	}
+}
+
+func mergeLatencyMap(dst, src map[string]*latencyPair) {
+	for k, v := range src {
+		if d, ok := dst[k]; ok {
+			d.merge(v)
+		} else {
+			dst[k] = v
+		}
+	}
+}
+
+var latencyQuantiles = []float64{0.5, 0.9, 0.99, 0.999}
+
+var latencyHeader = []string{"Op", "Count", "Mean(us)", "P50(us)", "P90(us)", "P99(us)", "P999(us)", "Max(us)"}
+
+func formatMicros(ns int64) string {
+	return strconv.FormatFloat(float64(ns)/float64(time.Microsecond), 'f', 1, 64)
+}
+
+// latencyRows 生成某个 key 下读、写两行延迟统计（无样本的一侧跳过）
+func latencyRows(key string, lp *latencyPair) [][]string {
+	var rows [][]string
+	for op := trace.OpRead; op <= trace.OpWrite; op++ {
+		h := &lp[op]
+		if h.n == 0 {
+			continue
+		}
+		row := []string{key, op.String(), strconv.FormatInt(h.n, 10), formatMicros(h.sum / h.n)}
+		for _, q := range latencyQuantiles {
+			row = append(row, formatMicros(h.quantile(q)))
+		}
+		row = append(row, formatMicros(h.max))
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func snapshotLatencyMap(m map[string]*latencyPair) (map[string]*latencyPair, []string) {
+	snap := make(map[string]*latencyPair, len(m))
+	keys := make([]string, 0, len(m))
+	for k, v := range m {
+		cp := &latencyPair{}
+		cp[0] = *v[0].clone()
+		cp[1] = *v[1].clone()
+		snap[k] = cp
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return snap, keys
+}
+
+// writeLatencyCSVs 输出 latency_stats_volume/minute/size.csv，trace 不含延迟时跳过
+func writeLatencyCSVs(outDir string, ag *Aggregator) error {
+	ls := ag.latency
+	ls.mu.Lock()
+	if ls.samples == 0 {
+		ls.mu.Unlock()
+		return nil
+	}
+	volSnap, volKeys := snapshotLatencyMap(ls.volMap)
+	minSnap, minKeys := snapshotLatencyMap(ls.minuteMap)
+	var sizeSnap [ioSizeBuckets]latencyPair
+	for i := range ls.sizeHist {
+		sizeSnap[i][0] = *ls.sizeHist[i][0].clone()
+		sizeSnap[i][1] = *ls.sizeHist[i][1].clone()
+	}
+	ls.mu.Unlock()
+
+	var rows [][]string
+	for _, k := range volKeys {
+		rows = append(rows, latencyRows(k, volSnap[k])...)
+	}
+	if err := writeCSV(filepath.Join(outDir, "latency_stats_volume.csv"), append([]string{"VolumeID"}, latencyHeader...), rows); err != nil {
+		return err
+	}
+
+	rows = nil
+	for _, k := range minKeys {
+		rows = append(rows, latencyRows(k, minSnap[k])...)
+	}
+	if err := writeCSV(filepath.Join(outDir, "latency_stats_minute.csv"), append([]string{"Minute"}, latencyHeader...), rows); err != nil {
+		return err
+	}
+
+	rows = nil
+	for i := range sizeSnap {
+		rows = append(rows, latencyRows(ioSizeBucketLabel(i), &sizeSnap[i])...)
+	}
+	return writeCSV(filepath.Join(outDir, "latency_stats_size.csv"), append([]string{"IOSize"}, latencyHeader...), rows)
+}
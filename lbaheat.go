@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"ana/trace"
+)
+
+// lbaCell 是 (时间桶, LBA 分箱) 上的读写计数
+type lbaCell struct {
+	bucket int64 // 时间桶起点 (Unix 秒)
+	bin    int64
+}
+
+type lbaVolume struct {
+	cells map[lbaCell]*CountPair
+}
+
+// lbaHeatmap 按时间桶 × LBA 分箱统计选定卷的读写次数与字节数，与条带模型无关
+type lbaHeatmap struct {
+	mu      sync.Mutex
+	sel     *volumeSelector
+	binSize int64
+	bucket  time.Duration
+	vols    map[string]*lbaVolume // 未命中的卷记为 nil
+}
+
+func newLBAHeatmap(sel *volumeSelector, binSize int64, bucket time.Duration) *lbaHeatmap {
+	return &lbaHeatmap{sel: sel, binSize: binSize, bucket: bucket, vols: make(map[string]*lbaVolume)}
+}
+
+// observe 将一次 IO 计入覆盖到的每个分箱：次数各加一，字节数按实际重叠部分计
+func (h *lbaHeatmap) observe(rec *trace.IORecord) {
+	if rec.Length <= 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	v, ok := h.vols[rec.Volume]
+	if !ok {
+		if h.sel.match(rec.Volume) {
+			v = &lbaVolume{cells: make(map[lbaCell]*CountPair)}
+		}
+		h.vols[rec.Volume] = v
+	}
+	if v == nil {
+		return
+	}
+	bucket := rec.Timestamp.Truncate(h.bucket).Unix()
+	isRead := rec.IsRead()
+	end := rec.Offset + rec.Length
+	first, last := blockRange(rec.Offset, rec.Length, h.binSize)
+	for b := first; b <= last; b++ {
+		lo := max(rec.Offset, b*h.binSize)
+		hi := min(end, (b+1)*h.binSize)
+		key := lbaCell{bucket, b}
+		cp, ok := v.cells[key]
+		if !ok {
+			cp = &CountPair{}
+			v.cells[key] = cp
+		}
+		cp.add(isRead, hi-lo)
+	}
+}
+
+// lbaMaxCells 是单个卷稠密矩阵的格子数上限（三个矩阵共约 96MB），
+// 超过时按整数倍放大时间桶与分箱，避免过小的 -heatmap_bin 或稀疏的高地址耗尽内存。
+// 合并后的次数是原格子次数之和（跨多个原分箱的 IO 会被计多次），字节数不受影响
+const lbaMaxCells = 1 << 22
+
+// lbaMaxRows 是矩阵的时间桶数上限，剩余的格子预算留给分箱
+const lbaMaxRows = 1 << 16
+
+// lbaMatrix 是一个卷的稠密矩阵：行为连续的时间桶，列为 firstBin 起连续的分箱（均可能已合并放大）
+type lbaMatrix struct {
+	start    int64 // 第一个时间桶 (Unix 秒)
+	step     int64 // 时间桶长度 (秒)
+	rows     int
+	cols     int
+	firstBin int64 // 第一列的分箱编号，起始偏移为 firstBin * binSize
+	reads    []int64
+	writes   []int64
+	bytes    []int64
+	binSize  int64
+}
+
+// matrix 把卷 v 的稀疏格子展开为稠密矩阵，格子数超过 lbaMaxCells 时合并相邻时间桶与分箱
+func (h *lbaHeatmap) matrix(vol string, v *lbaVolume) *lbaMatrix {
+	step := int64(h.bucket / time.Second)
+	if step <= 0 {
+		step = 1
+	}
+	minB, maxB := int64(math.MaxInt64), int64(math.MinInt64)
+	minBin, maxBin := int64(math.MaxInt64), int64(math.MinInt64)
+	for c := range v.cells {
+		minB = min(minB, c.bucket)
+		maxB = max(maxB, c.bucket)
+		minBin = min(minBin, c.bin)
+		maxBin = max(maxBin, c.bin)
+	}
+	rows := (maxB-minB)/step + 1
+	fy := (rows-1)/lbaMaxRows + 1
+	rows = (maxB-minB)/(step*fy) + 1
+	// 分箱按 fx 的整数倍对齐合并，保证 rows × cols 不超过上限
+	maxCols := lbaMaxCells / rows
+	fx := int64(1)
+	if maxBin-minBin+1 > maxCols {
+		fx = (maxBin-minBin)/(maxCols-2) + 1
+	}
+	cols := maxBin/fx - minBin/fx + 1
+	if fx > 1 || fy > 1 {
+		fmt.Printf("LBA 热力图 %s: 格子数超过 %d，分箱放大为 %d 字节，时间桶放大为 %ds\n",
+			vol, lbaMaxCells, h.binSize*fx, step*fy)
+	}
+
+	m := &lbaMatrix{
+		start:    minB,
+		step:     step * fy,
+		rows:     int(rows),
+		cols:     int(cols),
+		firstBin: minBin / fx,
+		binSize:  h.binSize * fx,
+	}
+	n := m.rows * m.cols
+	m.reads, m.writes, m.bytes = make([]int64, n), make([]int64, n), make([]int64, n)
+	for c, cp := range v.cells {
+		i := int((c.bucket-minB)/m.step)*m.cols + int(c.bin/fx-m.firstBin)
+		m.reads[i] += cp.Reads
+		m.writes[i] += cp.Writes
+		m.bytes[i] += cp.ReadBytes + cp.WriteBytes
+	}
+	return m
+}
+
+// writeCSV 逐行写出矩阵，表头为每个分箱的起始偏移
+func (m *lbaMatrix) writeCSV(path string, values []int64, loc *time.Location) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(bufio.NewWriterSize(f, 1<<20))
+	row := make([]string, m.cols+1)
+	row[0] = "Time"
+	for b := 0; b < m.cols; b++ {
+		row[b+1] = strconv.FormatInt((m.firstBin+int64(b))*m.binSize, 10)
+	}
+	if err := w.Write(row); err != nil {
+		return err
+	}
+	for r := 0; r < m.rows; r++ {
+		row[0] = time.Unix(m.start+int64(r)*m.step, 0).In(loc).Format("01-02 15:04:05")
+		for b := 0; b < m.cols; b++ {
+			row[b+1] = strconv.FormatInt(values[r*m.cols+b], 10)
+		}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	fmt.Printf("已写出: %s\n", path)
+	return nil
+}
+
+// heatColor 把 [0,1] 映射到 黑→蓝→红→黄→白 的色带
+func heatColor(t float64) color.RGBA {
+	stops := [...][3]float64{{0, 0, 0}, {30, 30, 200}, {220, 30, 30}, {250, 220, 40}, {255, 255, 255}}
+	t = math.Max(0, math.Min(1, t)) * float64(len(stops)-1)
+	i := int(t)
+	if i >= len(stops)-1 {
+		i = len(stops) - 2
+	}
+	f := t - float64(i)
+	var c [3]uint8
+	for k := range c {
+		c[k] = uint8(stops[i][k] + (stops[i+1][k]-stops[i][k])*f)
+	}
+	return color.RGBA{c[0], c[1], c[2], 255}
+}
+
+// lbaImageMax 是 PNG 单边最多的格子数，超过时按整数倍合并相邻格子（求和）
+const lbaImageMax = 2048
+
+// writePNG 渲染热力图：横轴为 LBA（从最低被访问的分箱起，左低右高），纵轴为时间（自上而下），颜色按 log(1+v) 归一化
+func (m *lbaMatrix) writePNG(path string, values []int64) error {
+	fx := (m.cols + lbaImageMax - 1) / lbaImageMax
+	fy := (m.rows + lbaImageMax - 1) / lbaImageMax
+	cols := (m.cols + fx - 1) / fx
+	rows := (m.rows + fy - 1) / fy
+	grid := make([]int64, cols*rows)
+	var peak int64
+	for r := 0; r < m.rows; r++ {
+		for c := 0; c < m.cols; c++ {
+			i := (r/fy)*cols + c/fx
+			grid[i] += values[r*m.cols+c]
+			peak = max(peak, grid[i])
+		}
+	}
+	// 格子太少时放大，便于查看
+	sx := max(1, 1024/cols)
+	sy := max(1, 768/rows)
+	img := image.NewRGBA(image.Rect(0, 0, cols*sx, rows*sy))
+	norm := math.Log1p(float64(peak))
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			t := 0.0
+			if norm > 0 {
+				t = math.Log1p(float64(grid[r*cols+c])) / norm
+			}
+			col := heatColor(t)
+			for y := r * sy; y < (r+1)*sy; y++ {
+				for x := c * sx; x < (c+1)*sx; x++ {
+					img.SetRGBA(x, y, col)
+				}
+			}
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("已写出: %s\n", path)
+	return nil
+}
+
+// writeLBAHeatmaps 为每个选中的卷输出 lba_heatmap/<卷>/heatmap_{reads,writes,bytes}.{csv,png}
+func writeLBAHeatmaps(outDir string, ag *Aggregator) error {
+	h := ag.lbaHeat
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	vols := make([]string, 0, len(h.vols))
+	for vol, v := range h.vols {
+		if v != nil && len(v.cells) > 0 {
+			vols = append(vols, vol)
+		}
+	}
+	sort.Strings(vols)
+	h.mu.Unlock()
+
+	// 逐个卷展开矩阵，同一时刻只保留一个卷的稠密矩阵
+	for _, vol := range vols {
+		h.mu.Lock()
+		m := h.matrix(vol, h.vols[vol])
+		h.mu.Unlock()
+		dir := filepath.Join(outDir, "lba_heatmap", safeFileName(vol))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		for _, out := range []struct {
+			name   string
+			values []int64
+		}{{"reads", m.reads}, {"writes", m.writes}, {"bytes", m.bytes}} {
+			if err := m.writeCSV(filepath.Join(dir, "heatmap_"+out.name+".csv"), out.values, time.Local); err != nil {
+				return err
+			}
+			if err := m.writePNG(filepath.Join(dir, "heatmap_"+out.name+".png"), out.values); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -6,11 +6,13 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"ana/internal/zstd"
 	"ana/providers/alicloud"
 	"ana/providers/msrc"
 	"ana/providers/tencent"
@@ -22,11 +24,8 @@ func listGzFiles(dir string) ([]string, error) {
 		if err != nil {
 			return err
 		}
-		if info.Mode().IsRegular() {
-			ext := filepath.Ext(path)
-			if ext == ".csv" || ext == ".gz" || ext == ".tgz" || strings.HasSuffix(path, ".tar.gz") {
-				paths = append(paths, path)
-			}
+		if info.Mode().IsRegular() && isTraceFile(path) {
+			paths = append(paths, path)
 		}
 		return nil
 	})
@@ -51,24 +50,151 @@ func parseTimeLocal(s string) (time.Time, bool) {
 	return time.Time{}, false
 }
 
+// buildStripeConfigs 由 EC 配置列表与块大小列表做笛卡尔积，未指定的一侧使用单值参数
+func buildStripeConfigs(ecList, sizeList string, blockSize int64, dataBlocks, localParities, parityBlocks int, layout string, disks int, placement Placement, failure *FailureSpec) ([]StripeConfig, error) {
+	ecs := [][3]int{{dataBlocks, localParities, parityBlocks}}
+	if ecList != "" {
+		parsed, err := parseECConfigs(ecList)
+		if err != nil {
+			return nil, err
+		}
+		ecs = parsed
+	}
+	sizes := []int64{blockSize}
+	if sizeList != "" {
+		sizes = sizes[:0]
+		for _, s := range splitList(sizeList) {
+			v, err := parseByteSize(s)
+			if err != nil {
+				return nil, err
+			}
+			sizes = append(sizes, v)
+		}
+	}
+	var cfgs []StripeConfig
+	for _, ec := range ecs {
+		for _, size := range sizes {
+			cfg := StripeConfig{BlockSize: size, DataBlocks: ec[0], LocalParities: ec[1], ParityBlocks: ec[2], Layout: layout, Disks: disks, Placement: placement, Failure: failure}
+			if cfg.LocalParities < 0 || cfg.LocalParities > cfg.DataBlocks {
+				return nil, fmt.Errorf("local parities must be in [0, %d] for %s", cfg.DataBlocks, cfg.ECLabel())
+			}
+			if layout == LayoutDeclustered && disks < cfg.width() {
+				return nil, fmt.Errorf("declustered layout needs at least %d disks for %s, got %d", cfg.width(), cfg.ECLabel(), disks)
+			}
+			if placement.Nodes > 0 && placement.Nodes < cfg.DiskCount() {
+				return nil, fmt.Errorf("placement needs at least %d nodes for %s, got %d", cfg.DiskCount(), cfg.ECLabel(), placement.Nodes)
+			}
+			if failure != nil {
+				// 失效单元启用节点放置时为节点编号，否则为磁盘编号，越界的单元不会命中任何条带
+				units, kind := cfg.DiskCount(), "disk"
+				if placement.Nodes > 0 {
+					units, kind = placement.Nodes, "node"
+				}
+				for _, u := range failure.Units {
+					if u >= units {
+						return nil, fmt.Errorf("failed %s %d out of range [0, %d) for %s", kind, u, units, cfg.ECLabel())
+					}
+				}
+			}
+			cfgs = append(cfgs, cfg)
+		}
+	}
+	if len(cfgs) == 0 {
+		return nil, fmt.Errorf("no stripe configs")
+	}
+	return cfgs, nil
+}
+
+// newParser 按 provider 名称选择解析器，未知名称按 tencent 处理
+func newParser(provider string) Parser {
+	switch strings.ToLower(provider) {
+	case "alicloud":
+		return alicloud.NewParser()
+	case "msrc":
+		return msrc.NewParser()
+	default:
+		return tencent.NewParser()
+	}
+}
+
 func main() {
+	args := os.Args[1:]
+	// 子命令: ana bench [flags] 在合成数据上测试累加吞吐随 worker 数的变化
+	if len(args) > 0 && args[0] == "bench" {
+		runBench(args[1:])
+		return
+	}
+	// 子命令: ana cache [flags] 只做缓存分析（reuse distance / MRC）
+	cacheMode := false
+	if len(args) > 0 && args[0] == "cache" {
+		cacheMode = true
+		args = args[1:]
+	}
+
 	// CLI flags
-	dir := flag.String("d", "", "directory containing .csv or .gz trace files (recursive)")
+	dir := flag.String("d", "", "directory containing .csv or compressed (.gz/.zst/.xz/.bz2/.lz4/.zip/.tar*) trace files (recursive); zstd window limit: -zstd_window_mem")
 	outDir := flag.String("o", "output", "output directory")
 	workers := flag.Int("w", 0, "number of parser workers (default: numCPU)")
 	provider := flag.String("provider", "", "trace provider: alicloud|tencent|msrc")
 	minuteBuf := flag.Int("minute_buf", 120, "按分钟的卷统计在内存缓存的分钟数量上限，超过后会落盘并清理")
 	disableMinuteVol := flag.Bool("no_minute_volume", false, "禁用按分钟的卷统计以降低内存占用")
-	queueSize := flag.Int("queue_size", 10000, "读取通道缓冲大小以控制峰值内存")
+	queueSize := flag.Int("queue_size", 10000, "读取通道缓冲的行数（按批次换算）以控制峰值内存")
 	maxLineMB := flag.Int("max_line_mb", 10, "单行最大字节数上限(MB)，过长将报错")
+	zstdWindowMem := flag.String("zstd_window_mem", "128M", "zstd 帧允许声明的最大窗口（每个解压流占用的内存），支持 K/M/G 后缀；zstd --long 或 --ultra 压缩的文件可能需要调大，最大约 2G")
+	readers := flag.Int("readers", 1, "同时读取的输入文件数；大于 1 时不同文件的记录按到达顺序交错进入顺序相关的分析器（单个文件内保持行序）")
+	gzThreads := flag.Int("gz_threads", 0, "多成员 gzip（bgzip/pigz/拼接）单个文件的并行解压 goroutine 数，1 表示顺序解压 (default: numCPU)")
 	from := flag.String("from", "", "起始时间，格式: 2006-01-02[ 15:04[:05]] 或 RFC3339")
 	to := flag.String("to", "", "结束时间，格式: 2006-01-02[ 15:04[:05]] 或 RFC3339")
-	targetVol := flag.String("target_vol", "", "指定统计条带更新的目标 Volume ID")
+	targetVol := flag.String("target_vol", "", "指定统计条带更新的目标 Volume ID，可用逗号分隔多个")
+	targetRegex := flag.String("target_regex", "", "按正则匹配参与条带分析的 Volume ID")
+	targetFile := flag.String("target_file", "", "每行一个 Volume ID 的文件，参与条带分析")
+	targetTop := flag.Int("target_top", 0, "对最繁忙的 N 个卷做条带分析（默认预扫描一遍输入统计）")
+	targetTopFrom := flag.String("target_top_from", "", "从已有的 volume_stats.csv 选取 -target_top 个卷，跳过预扫描")
 	stripeBlockSize := flag.Int64("stripe_block_size", 65536, "Stripe block size in bytes (default: 65536)")
 	dataBlocks := flag.Int("data_blocks", 10, "Number of data blocks in a stripe (default: 10)")
 	parityBlocks := flag.Int("parity_blocks", 4, "Number of parity blocks in a stripe (default: 4)")
-	flag.Parse()
+	localParities := flag.Int("local_parities", 0, "LRC 本地组数 l（每组一个本地校验），>0 时 -parity_blocks 表示全局校验数 r")
+	ecConfigs := flag.String("ec_configs", "", "逗号分隔的多个 EC 配置，如 2+1,4+2,10+4；三段式 12+2+2 表示 LRC(data+local+global)；与 -stripe_block_sizes 组合后一次读取评估所有配置")
+	stripeLayout := flag.String("stripe_layout", "dedicated", "条带布局: dedicated(固定校验盘)|rotated(RAID-5/6 left-symmetric 轮转校验)|declustered(分散校验)")
+	stripeDisks := flag.Int("stripe_disks", 0, "declustered 布局下的模拟磁盘数，需不少于 data+parity")
+	nodes := flag.Int("nodes", 0, "模拟存储节点数，>0 时将条带放置到节点上并输出节点负载 (stripe_node_*.csv)")
+	placementPolicy := flag.String("placement", "rr", "条带放置策略: rr(轮转)|random(随机)|chash(一致性哈希)")
+	placementSeed := flag.Int64("placement_seed", 1, "random 放置的随机种子")
+	vnodes := flag.Int("vnodes", 100, "一致性哈希每个节点的虚拟节点数")
+	failUnits := flag.String("fail_units", "", "逗号分隔的失效单元编号（启用 -nodes 时为节点，否则为磁盘），用于降级读与修复模拟")
+	failAt := flag.String("fail_at", "", "故障发生时间，格式同 -from；为空时从 trace 开头即失效")
+	repairRate := flag.String("repair_rate", "0", "后台重建丢失数据的速率(bytes/s)，支持 K/M/G 后缀，0 表示不修复")
+	coalesceWindows := flag.String("coalesce_windows", "1ms,10ms,100ms,1s,10s", "条带写合并模拟的窗口列表，输出 stripe_coalesce.csv")
+	stripeOpsMem := flag.String("stripe_ops_mem", "256M", "stripe_ops.csv 明细的内存预算（所有目标卷 × 条带配置共享），超出后把最大的缓冲排序落盘并在结束时外部归并；0 表示全部保存在内存")
+	spillDir := flag.String("spill_dir", "", "stripe_ops 落盘的临时目录，默认系统临时目录")
+	stripeBlockSizes := flag.String("stripe_block_sizes", "", "逗号分隔的多个条带块大小，如 4K,32K,1M；结果写入 <输出目录>/<EC>/<块大小>/")
+	sequential := flag.Bool("sequential", false, "按卷检测顺序流与跨步流 (sequential_stats.csv、sequential_jump_hist.csv)")
+	seqStreams := flag.Int("seq_streams", 8, "顺序流检测时每个卷同时跟踪的流数量")
+	seqStrideWindow := flag.Int64("seq_stride_window", 1<<20, "跨步流检测的最大步长(bytes)")
+	workingSet := flag.Bool("working_set", false, "按卷统计每分钟/小时/天及全程的 footprint (working_set_*.csv)")
+	wsBlockSize := flag.Int64("ws_block_size", 4096, "footprint 统计的 block 大小(bytes)")
+	wsExactLimit := flag.Int64("ws_exact_limit", 1<<20, "单个集合的精确统计 block 数上限，超过后使用 HyperLogLog 估计")
+	hotTopK := flag.Int("hot_topk", 0, "在所有卷上跟踪最热的 K 个条带/block（Space-Saving + Count-Min，输出 hot_*.csv），0 表示关闭")
+	hotCMSWidth := flag.Int("hot_cms_width", 1<<16, "热点统计 Count-Min sketch 每行的宽度，越大误差界越小")
+	heatmapVols := flag.String("heatmap_vols", "", "逗号分隔的卷 ID，输出 LBA × 时间热力图 (lba_heatmap/<卷>/)")
+	heatmapRegex := flag.String("heatmap_regex", "", "按正则选择输出 LBA 热力图的卷")
+	heatmapBin := flag.String("heatmap_bin", "256M", "LBA 热力图的地址分箱大小，支持 K/M/G 后缀")
+	heatmapBucket := flag.Duration("heatmap_bucket", time.Minute, "LBA 热力图的时间桶长度，如 10s、1m、1h")
+	cacheBlockSize := flag.Int64("cache_block_size", 4096, "[cache] 缓存 block 粒度(bytes)")
+	shardsRate := flag.Float64("shards_rate", 0.01, "[cache] SHARDS 初始空间采样率 (0,1]")
+	shardsMax := flag.Int("shards_max", 1<<16, "[cache] 每个 reuse distance 跟踪器最多保留的采样 key 数，超过后自动降低采样率")
+	cachePolicies := flag.String("cache_policies", "", "[cache] 逗号分隔的回放策略，如 lru,lfu,arc,s3fifo,2q；为空则不做策略模拟")
+	cacheSizes := flag.String("cache_sizes", "64M,256M,1G,4G", "[cache] 逗号分隔的缓存容量，支持 K/M/G/T 后缀")
+	cacheWriteMode := flag.String("cache_write_mode", "wb,wt", "[cache] 写策略: wb(write-back)、wt(write-through)，可同时指定")
+	cacheBucket := flag.String("cache_bucket", "hour", "[cache] 模拟结果的时间桶: minute|hour|day")
+	flag.CommandLine.Parse(args)
 	SetMaxLineBytes(*maxLineMB * 1024 * 1024)
+	if n, err := parseByteSize(*zstdWindowMem); err != nil {
+		fmt.Printf("zstd 窗口上限格式不正确: %v\n", err)
+		os.Exit(1)
+	} else {
+		zstd.SetMaxWindowSize(n)
+	}
 
 	var fromPtr, toPtr *time.Time
 	if *from != "" {
@@ -89,12 +215,20 @@ func main() {
 	}
 
 	if *dir == "" {
-		fmt.Println("请使用 -d 指定包含 .csv 或 .gz 的目录")
+		fmt.Println("请使用 -d 指定包含 .csv 或压缩 trace 文件的目录")
 		os.Exit(1)
 	}
 	if *workers <= 0 {
 		*workers = runtime.NumCPU()
 	}
+	if *readers <= 0 {
+		*readers = 1
+	}
+	if *gzThreads <= 0 {
+		*gzThreads = runtime.NumCPU()
+	}
+	// 并行解压的预读量与批次通道共用 -queue_size 换算出的内存预算，按 reader 数均分
+	SetGzipParallel(*gzThreads, int64(batchQueueSize(*queueSize, *workers))*batchBytes/int64(*readers))
 	if pt := strings.ToLower(*provider); pt != "alicloud" && pt != "tencent" && pt != "msrc" {
 		fmt.Println("请使用 -provider 指定 alicloud、tencent 或 msrc")
 		os.Exit(1)
@@ -111,85 +245,246 @@ func main() {
 		os.Exit(1)
 	}
 	if len(paths) == 0 {
-		fmt.Println("目录内未找到 .csv/.gz 文件")
+		fmt.Println("目录内未找到 .csv 或压缩 trace 文件")
 		os.Exit(1)
 	}
 	fmt.Printf("文件数: %d\n输出目录: %s\n并发 worker: %d\n", len(paths), *outDir, *workers)
+	if *readers > 1 {
+		fmt.Printf("并发读取文件数: %d\n", *readers)
+	}
 
-	// channel for raw lines
-	lineCh := make(chan string, *queueSize)
+	// channel for line batches
+	batchCh := make(chan *lineBatch, batchQueueSize(*queueSize, *workers))
 	var wg sync.WaitGroup
 	agg := NewAggregator()
 	agg.SetMinuteBufLimit(*minuteBuf)
 	agg.EnableMinuteVolume(!*disableMinuteVol)
-	agg.SetTargetVolume(*targetVol)
-	agg.SetStripeConfig(*stripeBlockSize, *dataBlocks, *parityBlocks)
-	agg.SetOnEvict(func(minKey string, mv map[string]*CountPair) {
-		if err := writeMinuteVolumeCSV(filepath.Join(*outDir, "volume_stats_minute"), minKey, mv, *targetVol == ""); err != nil {
+	targetIDs := splitList(*targetVol)
+	if *targetFile != "" {
+		ids, err := readVolumeIDFile(*targetFile)
+		if err != nil {
+			fmt.Printf("读取目标卷文件失败: %v\n", err)
+			os.Exit(1)
+		}
+		targetIDs = append(targetIDs, ids...)
+	}
+	if *targetTop > 0 && !cacheMode {
+		var counts map[string]*CountPair
+		if *targetTopFrom != "" {
+			counts, err = readVolumeStatsCSV(*targetTopFrom)
+		} else {
+			fmt.Println("预扫描输入以选取最繁忙的卷...")
+			counts, err = scanVolumeCounts(paths, newParser(*provider), *workers, *readers, batchQueueSize(*queueSize, *workers), fromPtr, toPtr)
+		}
+		if err != nil {
+			fmt.Printf("统计卷访问量失败: %v\n", err)
+			os.Exit(1)
+		}
+		top := topVolumeIDs(counts, *targetTop)
+		fmt.Printf("Top %d 目标卷: %s\n", len(top), strings.Join(top, ","))
+		targetIDs = append(targetIDs, top...)
+	}
+	targets, err := newVolumeSelector(targetIDs, *targetRegex)
+	if err != nil {
+		fmt.Printf("目标卷配置错误: %v\n", err)
+		os.Exit(1)
+	}
+	agg.SetTargets(targets)
+	layout, err := parseStripeLayout(*stripeLayout)
+	if err != nil {
+		fmt.Printf("条带配置错误: %v\n", err)
+		os.Exit(1)
+	}
+	placePolicy, err := parsePlacement(*placementPolicy)
+	if err != nil {
+		fmt.Printf("条带配置错误: %v\n", err)
+		os.Exit(1)
+	}
+	placement := Placement{Nodes: *nodes, Policy: placePolicy, Seed: *placementSeed, VNodes: *vnodes}
+	var failure *FailureSpec
+	if *failUnits != "" {
+		failure = &FailureSpec{}
+		for _, u := range splitList(*failUnits) {
+			n, err := strconv.Atoi(u)
+			if err != nil || n < 0 {
+				fmt.Printf("失效单元编号不正确: %s\n", u)
+				os.Exit(1)
+			}
+			failure.Units = append(failure.Units, n)
+		}
+		if *failAt != "" {
+			t, ok := parseTimeLocal(*failAt)
+			if !ok {
+				fmt.Printf("故障时间格式不正确: %s\n", *failAt)
+				os.Exit(1)
+			}
+			failure.At = t
+		}
+		if *repairRate != "0" {
+			v, err := parseByteSize(*repairRate)
+			if err != nil {
+				fmt.Printf("修复速率格式不正确: %v\n", err)
+				os.Exit(1)
+			}
+			failure.RepairRate = v
+		}
+	}
+	cfgs, err := buildStripeConfigs(*ecConfigs, *stripeBlockSizes, *stripeBlockSize, *dataBlocks, *localParities, *parityBlocks, layout, *stripeDisks, placement, failure)
+	if err != nil {
+		fmt.Printf("条带配置错误: %v\n", err)
+		os.Exit(1)
+	}
+	agg.SetStripeConfigs(cfgs)
+	if len(cfgs) > 1 {
+		fmt.Printf("条带配置数: %d\n", len(cfgs))
+	}
+	var windows []time.Duration
+	for _, s := range splitList(*coalesceWindows) {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			fmt.Printf("合并窗口格式不正确: %s\n", s)
+			os.Exit(1)
+		}
+		windows = append(windows, d)
+	}
+	agg.SetCoalesceWindows(windows)
+	if targets != nil && !cacheMode && *stripeOpsMem != "0" {
+		budget, err := parseByteSize(*stripeOpsMem)
+		if err != nil {
+			fmt.Printf("stripe_ops 内存预算格式不正确: %v\n", err)
+			os.Exit(1)
+		}
+		agg.SetStripeOpsBudget(budget, *spillDir)
+	}
+	agg.SetOnEvict(func(minKey string, mv map[string]*CountPair, again bool) {
+		if err := writeMinuteVolumeCSV(filepath.Join(*outDir, "volume_stats_minute"), minKey, mv, targets == nil || again); err != nil {
 			fmt.Printf("写 volume-by-minute 失败: %v\n", err)
 		}
 	})
 	agg.SetTimeRange(fromPtr, toPtr)
+	if cacheMode {
+		agg.EnableCacheAnalysis(*cacheBlockSize, *shardsRate, *shardsMax)
+		if policies := splitList(*cachePolicies); len(policies) > 0 {
+			var sizes []int64
+			for _, s := range splitList(*cacheSizes) {
+				v, err := parseByteSize(s)
+				if err != nil {
+					fmt.Printf("缓存容量格式不正确: %v\n", err)
+					os.Exit(1)
+				}
+				sizes = append(sizes, v)
+			}
+			layouts := map[string]string{"minute": "01-02 15:04", "hour": "01-02 15", "day": "01-02"}
+			layout, ok := layouts[strings.ToLower(*cacheBucket)]
+			if !ok {
+				fmt.Println("-cache_bucket 只支持 minute、hour 或 day")
+				os.Exit(1)
+			}
+			modes := splitList(strings.ToLower(*cacheWriteMode))
+			for _, m := range modes {
+				if m != "wb" && m != "wt" {
+					fmt.Printf("未知写策略: %s\n", m)
+					os.Exit(1)
+				}
+			}
+			if err := agg.SetCacheSimulation(policies, sizes, layout, modes); err != nil {
+				fmt.Printf("缓存模拟配置错误: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+	if *sequential {
+		agg.EnableSequential(*seqStreams, *seqStrideWindow)
+	}
+	if *workingSet {
+		agg.EnableWorkingSet(*wsBlockSize, *wsExactLimit)
+	}
+	if (*heatmapVols != "" || *heatmapRegex != "") && !cacheMode {
+		sel, err := newVolumeSelector(splitList(*heatmapVols), *heatmapRegex)
+		if err != nil {
+			fmt.Printf("热力图卷配置错误: %v\n", err)
+			os.Exit(1)
+		}
+		bin, err := parseByteSize(*heatmapBin)
+		if err != nil {
+			fmt.Printf("热力图分箱大小格式不正确: %v\n", err)
+			os.Exit(1)
+		}
+		agg.EnableLBAHeatmap(sel, bin, *heatmapBucket)
+	}
+	if *hotTopK > 0 && !cacheMode {
+		agg.EnableHotSpots(*hotTopK, cfgs[0].BlockSize, cfgs[0].DataBlocks, *hotCMSWidth)
+	}
 
 	var totalParsed uint64
 	var parseErrCount uint64
 
 	// choose provider parser
-	var p Parser
-	switch strings.ToLower(*provider) {
-	case "alicloud":
-		p = alicloud.NewParser()
-	case "tencent":
-		p = tencent.NewParser()
-	case "msrc":
-		p = msrc.NewParser()
-	default:
-		p = tencent.NewParser()
-	}
+	p := newParser(*provider)
 
-	// start workers
+	// start workers；gate 让顺序相关的分析器按批次送出顺序处理记录，结果与 -w 无关
+	gate := newBatchGate()
 	for i := 0; i < *workers; i++ {
 		wg.Add(1)
 		go func(id int) {
 			defer wg.Done()
-			parserWorker(lineCh, p, agg, &totalParsed, &parseErrCount)
+			parserWorker(batchCh, p, agg, gate, &totalParsed, &parseErrCount)
 		}(i)
 	}
 
-	// producer: read tar.gz and stream lines into lineCh
-	for _, p := range paths {
-		prev := atomic.LoadUint64(&totalParsed) + atomic.LoadUint64(&parseErrCount)
-		cnt, err := streamLinesAuto(p, lineCh)
-		if err != nil {
-			fmt.Printf("读取 trace 文件失败: %v\n", err)
-			close(lineCh)
-			wg.Wait()
-			os.Exit(1)
-		}
-		for {
-			if atomic.LoadUint64(&totalParsed)+atomic.LoadUint64(&parseErrCount) >= prev+cnt {
-				break
+	// 文件完成回调：文件的记录全部合并进 agg 后依次触发，输出进度并写一次阶段性统计
+	fileDone := make(chan *fileProgress, len(paths))
+	var hookWG sync.WaitGroup
+	hookWG.Add(1)
+	go func() {
+		defer hookWG.Done()
+		finished := 0
+		for fp := range fileDone {
+			finished++
+			fmt.Printf("文件完成 [%d/%d]: %s (%d 行)\n", finished, len(paths), fp.path, fp.lines)
+			if cacheMode {
+				continue
+			}
+			if err := writeDayCSV(filepath.Join(*outDir, "time_stats_day.csv"), agg); err != nil {
+				fmt.Printf("写 day CSV 失败: %v\n", err)
+			}
+			if err := writeHourCSV(filepath.Join(*outDir, "time_stats_hour.csv"), agg); err != nil {
+				fmt.Printf("写 hour CSV 失败: %v\n", err)
+			}
+			if err := writeMinuteCSV(filepath.Join(*outDir, "time_stats_minute.csv"), agg); err != nil {
+				fmt.Printf("写 minute CSV 失败: %v\n", err)
 			}
-			time.Sleep(100 * time.Millisecond)
-		}
-		if err := writeDayCSV(filepath.Join(*outDir, "time_stats_day.csv"), agg); err != nil {
-			fmt.Printf("写 day CSV 失败: %v\n", err)
-		}
-		if err := writeHourCSV(filepath.Join(*outDir, "time_stats_hour.csv"), agg); err != nil {
-			fmt.Printf("写 hour CSV 失败: %v\n", err)
 		}
-		if err := writeMinuteCSV(filepath.Join(*outDir, "time_stats_minute.csv"), agg); err != nil {
-			fmt.Printf("写 minute CSV 失败: %v\n", err)
+	}()
+
+	// producer: read files concurrently and stream line batches into batchCh
+	// 出错的文件已逐个报告并跳过，其余文件照常聚合；全部输出写完后再以非零状态退出
+	readErr := streamFiles(paths, *readers, batchCh, fileDone)
+	exit := func() {
+		if readErr != nil {
+			fmt.Printf("警告: %v，结果不包含这些文件中出错位置之后的记录\n", readErr)
+			os.Exit(1)
 		}
 	}
 
-	// close channel and wait workers
-	close(lineCh)
+	// close channel and wait workers, then drain the remaining file hooks
+	close(batchCh)
 	wg.Wait()
+	close(fileDone)
+	hookWG.Wait()
 
 	fmt.Printf("解析完成。成功解析行数(估计): %d，解析错误(估计): %d\n",
 		atomic.LoadUint64(&totalParsed), atomic.LoadUint64(&parseErrCount))
 
+	if cacheMode {
+		if err := writeCacheCSVs(*outDir, agg); err != nil {
+			fmt.Printf("写 cache CSV 失败: %v\n", err)
+		}
+		fmt.Println("全部完成。")
+		exit()
+		return
+	}
+
 	// 写出 CSV 文件
 	if err := writeDayCSV(filepath.Join(*outDir, "time_stats_day.csv"), agg); err != nil {
 		fmt.Printf("写 day CSV 失败: %v\n", err)
@@ -203,27 +498,37 @@ func main() {
 	if err := writeVolumeCSV(filepath.Join(*outDir, "volume_stats.csv"), agg); err != nil {
 		fmt.Printf("写 volume CSV 失败: %v\n", err)
 	}
-
-	if *targetVol != "" {
-		if err := writeStripeOpsCSV(filepath.Join(*outDir, "stripe_ops.csv"), agg); err != nil {
-			fmt.Printf("写 stripe ops CSV 失败: %v\n", err)
-		}
+	if err := writeIOSizeHistCSVs(*outDir, agg); err != nil {
+		fmt.Printf("写 io size hist CSV 失败: %v\n", err)
+	}
+	if err := writeSequentialCSVs(*outDir, agg); err != nil {
+		fmt.Printf("写 sequential CSV 失败: %v\n", err)
+	}
+	if err := writeWorkingSetCSVs(*outDir, agg); err != nil {
+		fmt.Printf("写 working set CSV 失败: %v\n", err)
+	}
+	if err := writeLatencyCSVs(*outDir, agg); err != nil {
+		fmt.Printf("写 latency CSV 失败: %v\n", err)
+	}
+	if err := writeHotCSVs(*outDir, agg); err != nil {
+		fmt.Printf("写 hot spot CSV 失败: %v\n", err)
+	}
+	if err := writeLBAHeatmaps(*outDir, agg); err != nil {
+		fmt.Printf("写 LBA 热力图失败: %v\n", err)
 	}
 
-	if err := writeVolumeByMinuteDir(filepath.Join(*outDir, "volume_stats_minute"), agg, *targetVol == ""); err != nil {
+	if err := writeVolumeByMinuteDir(filepath.Join(*outDir, "volume_stats_minute"), agg, targets == nil); err != nil {
 		fmt.Printf("写 volume-by-minute 失败: %v\n", err)
 	}
 
-	if *targetVol != "" {
-		if err := writeStripeStats(filepath.Join(*outDir, "stripe_stats.csv"), agg); err != nil {
-			fmt.Printf("写 stripe stats 失败: %v\n", err)
-		}
-		if err := writeStripeHeatMap(filepath.Join(*outDir, "stripe_block_heatmap.csv"), agg); err != nil {
-			fmt.Printf("写 stripe heatmap 失败: %v\n", err)
+	if targets != nil {
+		if err := writeStripeOutputs(*outDir, agg); err != nil {
+			fmt.Printf("写 stripe 结果失败: %v\n", err)
 		}
 	}
 
 	// 输出 top volumes
 	printTopVolumes(agg, 10)
 	fmt.Println("全部完成。")
+	exit()
 }
@@ -1,72 +1,93 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"strings"
 	"sync/atomic"
-	"time"
+
+	"ana/trace"
 )
 
-var unknownIOWarnCount uint64
+var parseErrWarnCount uint64
 
+// Parser 将一行原始 trace 解析为 IORecord，失败时返回 *trace.ParseError。
+// ParseBytes 不保留 line 的引用，worker 用它直接解析批次缓冲区里的行
 type Parser interface {
-	Parse(line string) (time.Time, string, string, int64, int64, bool)
+	Parse(line string) (trace.IORecord, error)
+	ParseBytes(line []byte) (trace.IORecord, error)
 }
 
-func parserWorker(lineCh <-chan string, parser Parser, agg *Aggregator, totalParsed *uint64, parseErrCount *uint64) {
-	for line := range lineCh {
-		ts, ioType, volID, offset, size, ok := parser.Parse(line)
-		if !ok {
-			atomic.AddUint64(parseErrCount, 1)
-			continue
+// parserWorker 逐批解析行并累加到 worker 本地分片，定期合并到 agg；
+// 每个批次解析完后按序号通过 gate，把记录交给顺序相关的分析器。
+// 解析计数在合并时才累加到 totalParsed/parseErrCount；批次所属文件的进度也在合并之后才释放，
+// 因此文件完成的通知总是发生在它的记录全部进入 agg 之后。
+func parserWorker(batchCh <-chan *lineBatch, parser Parser, agg *Aggregator, gate *batchGate, totalParsed *uint64, parseErrCount *uint64) {
+	local := agg.newLocal()
+	var parsed, failed uint64
+	var held []*fileProgress // 已解析、尚未合并的批次所属文件
+	flush := func() {
+		local.flush()
+		for _, fp := range held {
+			fp.release()
+		}
+		held = held[:0]
+		if parsed > 0 {
+			atomic.AddUint64(totalParsed, parsed)
 		}
-		agg.addRecord(ts, ioType, volID, offset, size)
-		atomic.AddUint64(totalParsed, 1)
+		if failed > 0 {
+			atomic.AddUint64(parseErrCount, failed)
+		}
+		parsed, failed = 0, 0
 	}
-}
-
-// normalizeIOType: 更健壮的 IO type 解析，返回 "0" 或 "1"
-func normalizeIOType(s string) string {
-	// possible formats: "Read(0)", "Write(1)", "0", "1", "\"Read(0)\"" etc.
-	s = strings.TrimSpace(s)
-	s = strings.Trim(s, "\"")
-	l := strings.ToLower(s)
-
-	// try extract digit inside parentheses anywhere
-	if idx := strings.Index(l, "("); idx >= 0 {
-		// find closing ')'
-		if j := strings.Index(l[idx:], ")"); j >= 0 {
-			inner := strings.TrimSpace(l[idx+1 : idx+j])
-			if inner == "0" || inner == "1" {
-				return inner
+	defer flush()
+	for {
+		var b *lineBatch
+		var ok bool
+		select {
+		case b, ok = <-batchCh:
+		default:
+			// 通道暂空：先合并本地结果，让已读完的文件尽快得到完成通知
+			flush()
+			b, ok = <-batchCh
+		}
+		if !ok {
+			return
+		}
+		b.forEachLine(func(line []byte, lineNo uint64) {
+			pos := trace.SourcePos{File: b.file, Line: lineNo}
+			rec, err := parser.ParseBytes(line)
+			if err != nil {
+				failed++
+				reportParseError(pos, err)
+				return
 			}
+			rec.Source = pos
+			local.add(&rec)
+			parsed++
+		})
+		gate.enter(b.seq)
+		local.observeOrdered()
+		gate.leave()
+		if b.src != nil {
+			held = append(held, b.src)
+		}
+		putBatch(b)
+		if parsed+failed >= localFlushEvery {
+			flush()
 		}
 	}
+}
 
-	// explicit words
-	if strings.Contains(l, "read") {
-		return "0"
-	}
-	if strings.Contains(l, "write") {
-		return "1"
-	}
-
-	// plain digits
-	if l == "0" || l == "1" {
-		return l
-	}
-
-	// prefix check
-	if strings.HasPrefix(l, "r") {
-		return "0"
+// reportParseError 打印前若干条解析错误（表头行不打印）
+func reportParseError(pos trace.SourcePos, err error) {
+	if errors.Is(err, trace.ErrHeader) {
+		return
 	}
-	if strings.HasPrefix(l, "w") {
-		return "1"
+	var pe *trace.ParseError
+	if errors.As(err, &pe) {
+		pe.Pos = pos
 	}
-
-	// fallback: conservative treat as write
-	if atomic.AddUint64(&unknownIOWarnCount, 1) <= 100 {
-		fmt.Printf("警告: 未知 IOType='%s'，按 write 处理\n", s)
+	if atomic.AddUint64(&parseErrWarnCount, 1) <= 100 {
+		fmt.Printf("警告: 解析失败 %v\n", err)
 	}
-	return "1"
 }
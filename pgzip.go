@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// 多成员 gzip（bgzip、pigz 分块、cat 拼接的 .gz）的每个成员都可以独立解压。
+// 并行读取器先在压缩流中扫描成员头，把文件切成若干段交给 goroutine 推测解压，
+// 再按文件顺序拼接输出：只有当前一段恰好在下一段的起点结束时，该起点才被确认为成员边界，
+// 否则丢弃这一段并从已确认的位置顺序补解，因此即使扫描到假的成员头也不会出错。
+// 单成员文件只会得到一段，退化为普通的顺序解压。
+
+var (
+	gzipThreads   = 1
+	gzipReadAhead = int64(4 * batchBytes)
+)
+
+// SetGzipParallel 设置单个 gzip 文件的并行解压 goroutine 数与预读的解压数据总量(bytes)
+func SetGzipParallel(threads int, readAhead int64) {
+	if threads > 0 {
+		gzipThreads = threads
+	}
+	if readAhead > 0 {
+		gzipReadAhead = readAhead
+	}
+}
+
+// newGzipReader 打开 f 上的 gzip 流，gzipThreads > 1 且 f 是不小于 1MB 的普通文件时使用并行解压
+func newGzipReader(f *os.File) (io.ReadCloser, error) {
+	if gzipThreads > 1 {
+		if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() && fi.Size() >= 1<<20 {
+			return newParallelGzipReader(f, fi.Size(), gzipThreads, gzipReadAhead)
+		}
+	}
+	return gzip.NewReader(f)
+}
+
+var chunkPool = sync.Pool{
+	New: func() any { return make([]byte, batchBytes) },
+}
+
+// gzSegment 是从压缩偏移 start 开始推测解压的一段，解压到第一个不早于 limit 的成员尾为止
+type gzSegment struct {
+	start int64
+	limit atomic.Int64  // 下一段的起点，尚未确定时为 MaxInt64
+	out   chan []byte   // 解压出的数据块，解压结束后关闭
+	end   int64         // 最后一个成员尾之后的压缩偏移，out 关闭后有效
+	err   error         // 解压错误，out 关闭后有效
+	stop  chan struct{} // 段被丢弃时关闭，worker 尽快退出
+	slot  bool          // 由 plan 启动、占用一个并发名额
+}
+
+func newGzSegment(start int64, outChunks int) *gzSegment {
+	s := &gzSegment{start: start, out: make(chan []byte, outChunks), stop: make(chan struct{})}
+	s.limit.Store(math.MaxInt64)
+	return s
+}
+
+// discard 丢弃段内已解压的数据并让 worker 退出
+func (s *gzSegment) discard() {
+	close(s.stop)
+	for c := range s.out {
+		chunkPool.Put(c[:cap(c)])
+	}
+}
+
+// countingReader 记录从底层读出的字节数，配合 bufio.Reader.Buffered 得到 gzip 已消费的精确位置
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// decode 从 s.start 起逐个成员解压，直到某个成员在 limit 处或之后结束、到达文件尾或出错
+func (s *gzSegment) decode(f io.ReaderAt, size int64) {
+	defer close(s.out)
+	cr := &countingReader{r: io.NewSectionReader(f, s.start, size-s.start)}
+	br := bufio.NewReaderSize(cr, 64*1024)
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		s.err = err
+		return
+	}
+	zr.Multistream(false)
+	chunk := chunkPool.Get().([]byte)
+	n := 0
+	send := func() bool {
+		select {
+		case <-s.stop:
+			return false
+		default:
+		}
+		select {
+		case s.out <- chunk[:n]:
+			chunk, n = chunkPool.Get().([]byte), 0
+			return true
+		case <-s.stop:
+			return false
+		}
+	}
+	for {
+		m, err := zr.Read(chunk[n:])
+		n += m
+		if err == io.EOF {
+			// 成员结束：bufio 可能多读了下一成员的开头，扣掉缓冲中的部分即为成员尾
+			pos := s.start + cr.n - int64(br.Buffered())
+			if pos >= s.limit.Load() || pos >= size {
+				s.end = pos
+				if n > 0 && !send() {
+					return
+				}
+				chunkPool.Put(chunk)
+				return
+			}
+			if err := zr.Reset(br); err != nil {
+				s.err = err
+				return
+			}
+			zr.Multistream(false)
+			continue
+		}
+		if err != nil {
+			s.err = err
+			return
+		}
+		if n == len(chunk) && !send() {
+			return
+		}
+	}
+}
+
+// parallelGzipReader 按文件顺序输出各段的解压数据
+type parallelGzipReader struct {
+	f       io.ReaderAt
+	size    int64
+	chunks  int // 每段的输出缓冲块数
+	segs    chan *gzSegment
+	slots   chan struct{} // 同时解压的段数上限
+	closed  chan struct{}
+	once    sync.Once
+	cur     *gzSegment
+	pending *gzSegment // 补解间隙时暂存的下一段
+	buf     []byte
+	chunk   []byte
+	pos     int64 // 已输出数据在压缩流中对应的位置，总是已确认的成员边界
+	err     error
+}
+
+// newParallelGzipReader 创建并行读取器：threads 段同时解压，解压后的数据最多预读约 readAhead 字节。
+// 段的压缩大小按 4 倍压缩比估算，使每段解压后大致能放进各自的输出缓冲。
+func newParallelGzipReader(f io.ReaderAt, size int64, threads int, readAhead int64) (*parallelGzipReader, error) {
+	hdr := make([]byte, 10)
+	if _, err := f.ReadAt(hdr, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if !isGzipHeader(hdr) {
+		return nil, gzip.ErrHeader
+	}
+	share := readAhead / int64(threads)
+	r := &parallelGzipReader{
+		f:      f,
+		size:   size,
+		chunks: max(int(share/batchBytes), 2),
+		segs:   make(chan *gzSegment, threads),
+		slots:  make(chan struct{}, threads),
+		closed: make(chan struct{}),
+	}
+	go r.plan(min(max(share/4, 64*1024), 16<<20))
+	return r, nil
+}
+
+// isGzipHeader 判断 b 开头是否像一个 gzip 成员头（magic、deflate、保留位为 0、合法的 XFL/OS）
+func isGzipHeader(b []byte) bool {
+	if len(b) < 10 || b[0] != 0x1f || b[1] != 0x8b || b[2] != 8 || b[3]&0xe0 != 0 {
+		return false
+	}
+	if b[8] != 0 && b[8] != 2 && b[8] != 4 {
+		return false
+	}
+	return b[9] <= 13 || b[9] == 255
+}
+
+// plan 顺序扫描压缩文件中的成员头，每隔约 segSize 取一个作为新段的起点并启动解压
+func (r *parallelGzipReader) plan(segSize int64) {
+	defer close(r.segs)
+	var prev *gzSegment
+	launch := func(start int64) bool {
+		select {
+		case r.slots <- struct{}{}:
+		case <-r.closed:
+			return false
+		}
+		seg := newGzSegment(start, r.chunks)
+		seg.slot = true
+		go seg.decode(r.f, r.size)
+		if prev != nil {
+			prev.limit.Store(start)
+		}
+		prev = seg
+		select {
+		case r.segs <- seg:
+			return true
+		case <-r.closed:
+			seg.discard()
+			return false
+		}
+	}
+	if !launch(0) {
+		return
+	}
+
+	magic := []byte{0x1f, 0x8b, 0x08}
+	buf := make([]byte, 1<<20)
+	next := segSize
+	for off := next; off < r.size; {
+		n, err := r.f.ReadAt(buf, off)
+		data := buf[:n]
+		adv := int64(max(n-len(magic)+1, 1))
+		for i := 0; ; {
+			j := bytes.Index(data[i:], magic)
+			if j < 0 {
+				break
+			}
+			p := i + j
+			if p+10 > n && n == len(buf) {
+				// 成员头跨过了读缓冲末尾，下一轮从这里重新读
+				adv = int64(p)
+				break
+			}
+			if cand := off + int64(p); cand >= next && isGzipHeader(data[p:]) {
+				if !launch(cand) {
+					return
+				}
+				next = cand + segSize
+			}
+			i = p + 1
+		}
+		if err != nil {
+			return
+		}
+		// 下一个段起点之前的成员头用不到，直接跳过
+		off = max(off+adv, next)
+	}
+}
+
+// nextSegment 取出与已确认位置 r.pos 衔接的下一段；起点落在已输出范围内的段被丢弃，
+// 起点之前有未覆盖的间隙时，启动一段从 r.pos 开始的顺序补解
+func (r *parallelGzipReader) nextSegment() (*gzSegment, bool) {
+	for {
+		seg := r.pending
+		r.pending = nil
+		if seg == nil {
+			var ok bool
+			if seg, ok = <-r.segs; !ok {
+				if r.pos >= r.size {
+					return nil, false
+				}
+				// 没有更多的段，剩余部分顺序解压到文件尾
+				gap := newGzSegment(r.pos, r.chunks)
+				go gap.decode(r.f, r.size)
+				return gap, true
+			}
+		}
+		switch {
+		case seg.start == r.pos:
+			return seg, true
+		case seg.start < r.pos:
+			seg.discard()
+			r.release(seg)
+		default:
+			r.pending = seg
+			gap := newGzSegment(r.pos, r.chunks)
+			gap.limit.Store(seg.start)
+			go gap.decode(r.f, r.size)
+			return gap, true
+		}
+	}
+}
+
+func (r *parallelGzipReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.chunk != nil {
+			chunkPool.Put(r.chunk[:cap(r.chunk)])
+			r.chunk = nil
+		}
+		if r.cur == nil {
+			seg, ok := r.nextSegment()
+			if !ok {
+				r.err = io.EOF
+				continue
+			}
+			r.cur = seg
+		}
+		c, ok := <-r.cur.out
+		if !ok {
+			if r.cur.err != nil {
+				r.err = r.cur.err
+				continue
+			}
+			r.pos = r.cur.end
+			r.release(r.cur)
+			r.cur = nil
+			continue
+		}
+		r.chunk, r.buf = c, c
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// release 归还 seg 占用的并发名额，补解段不占名额
+func (r *parallelGzipReader) release(seg *gzSegment) {
+	if seg.slot {
+		<-r.slots
+	}
+}
+
+// Close 停止扫描与所有未完成的解压
+func (r *parallelGzipReader) Close() error {
+	r.once.Do(func() {
+		close(r.closed)
+		if r.cur != nil {
+			r.cur.discard()
+		}
+		if r.pending != nil {
+			r.pending.discard()
+		}
+		for seg := range r.segs {
+			seg.discard()
+		}
+	})
+	return nil
+}
@@ -1,39 +1,76 @@
 package alicloud
 
 import (
+	"bytes"
 	"encoding/csv"
-	"strconv"
 	"strings"
 	"time"
+
+	"ana/trace"
 )
 
 type Parser struct{}
 
 func NewParser() *Parser { return &Parser{} }
 
-func (p *Parser) Parse(line string) (time.Time, string, string, int64, int64, bool) {
+// Parse 解析一行 AliCloud 块 trace: device_id,opcode,offset,length,timestamp(us)
+func (p *Parser) Parse(line string) (trace.IORecord, error) {
+	return p.ParseBytes([]byte(line))
+}
+
+// ParseBytes 与 Parse 相同但直接处理 []byte；无引号的行走零分配切分，
+// 只有 Volume 需要拷贝成字符串，line 在返回后即可复用
+func (p *Parser) ParseBytes(line []byte) (trace.IORecord, error) {
+	var buf [8][]byte
+	rec, ok := trace.SplitFields(line, buf[:0])
+	if !ok || len(line) == 0 {
+		return p.ParseCSV(string(line))
+	}
+	return p.parseFields(rec)
+}
+
+// ParseCSV 用 encoding/csv 解析一行，处理带引号的字段
+func (p *Parser) ParseCSV(line string) (trace.IORecord, error) {
 	r := csv.NewReader(strings.NewReader(line))
 	r.FieldsPerRecord = -1
 	rec, err := r.Read()
-	if err != nil || len(rec) < 5 {
-		return time.Time{}, "", "", 0, 0, false
-	}
-	if strings.EqualFold(strings.TrimSpace(rec[0]), "device_id") {
-		return time.Time{}, "", "", 0, 0, false
-	}
-	deviceID := strings.TrimSpace(rec[0])
-	opcode := strings.TrimSpace(rec[1])
-	
-	offsetStr := strings.TrimSpace(rec[2])
-	sizeStr := strings.TrimSpace(rec[3])
-	offset, _ := strconv.ParseInt(offsetStr, 10, 64)
-	size, _ := strconv.ParseInt(sizeStr, 10, 64)
-
-	tsMicrosStr := strings.TrimSpace(rec[4])
-	tsMicros, err := strconv.ParseInt(tsMicrosStr, 10, 64)
 	if err != nil {
-		return time.Time{}, "", "", 0, 0, false
+		return trace.IORecord{}, &trace.ParseError{Reason: "malformed csv", Err: err}
+	}
+	fields := make([][]byte, len(rec))
+	for i, f := range rec {
+		fields[i] = []byte(strings.TrimSpace(f))
+	}
+	return p.parseFields(fields)
+}
+
+// parseFields 解析已切分并去掉空白的字段
+func (p *Parser) parseFields(rec [][]byte) (trace.IORecord, error) {
+	if len(rec) < 5 {
+		return trace.IORecord{}, trace.Errorf("expected at least 5 columns, got %d", len(rec))
+	}
+	if bytes.EqualFold(rec[0], []byte("device_id")) {
+		return trace.IORecord{}, trace.HeaderError()
+	}
+
+	offset, err := trace.ParseInt(rec[2])
+	if err != nil {
+		return trace.IORecord{}, trace.FieldError("offset", string(rec[2]), err)
+	}
+	size, err := trace.ParseInt(rec[3])
+	if err != nil {
+		return trace.IORecord{}, trace.FieldError("length", string(rec[3]), err)
+	}
+	tsMicros, err := trace.ParseInt(rec[4])
+	if err != nil {
+		return trace.IORecord{}, trace.FieldError("timestamp", string(rec[4]), err)
 	}
 	ts := time.Unix(tsMicros/1e6, (tsMicros%1e6)*1e3).UTC().Local()
-	return ts, opcode, deviceID, offset, size, true
+	return trace.IORecord{
+		Timestamp: ts,
+		Op:        trace.ParseOpBytes(rec[1]),
+		Volume:    string(rec[0]),
+		Offset:    offset,
+		Length:    size,
+	}, nil
 }
@@ -1,46 +1,93 @@
 package msrc
 
 import (
+	"bytes"
 	"encoding/csv"
-	"strconv"
 	"strings"
 	"time"
+
+	"ana/trace"
 )
 
 type Parser struct{}
 
 func NewParser() *Parser { return &Parser{} }
 
-func (p *Parser) Parse(line string) (time.Time, string, string, int64, int64, bool) {
+// Parse 解析一行 MSR-Cambridge trace:
+// Timestamp,Hostname,DiskNumber,Type,Offset,Size,ResponseTime
+// Timestamp 为 Windows filetime（100ns 计数）
+func (p *Parser) Parse(line string) (trace.IORecord, error) {
+	return p.ParseBytes([]byte(line))
+}
+
+// ParseBytes 与 Parse 相同但直接处理 []byte；无引号的行走零分配切分，
+// 只有 Volume 需要拷贝成字符串，line 在返回后即可复用
+func (p *Parser) ParseBytes(line []byte) (trace.IORecord, error) {
+	var buf [8][]byte
+	rec, ok := trace.SplitFields(line, buf[:0])
+	if !ok || len(line) == 0 {
+		return p.ParseCSV(string(line))
+	}
+	return p.parseFields(rec)
+}
+
+// ParseCSV 用 encoding/csv 解析一行，处理带引号的字段
+func (p *Parser) ParseCSV(line string) (trace.IORecord, error) {
 	r := csv.NewReader(strings.NewReader(line))
 	r.FieldsPerRecord = -1
 	rec, err := r.Read()
-	if err != nil || len(rec) < 7 {
-		return time.Time{}, "", "", 0, 0, false
+	if err != nil {
+		return trace.IORecord{}, &trace.ParseError{Reason: "malformed csv", Err: err}
 	}
-	if strings.EqualFold(strings.TrimSpace(rec[0]), "Timestamp") {
-		return time.Time{}, "", "", 0, 0, false
+	fields := make([][]byte, len(rec))
+	for i, f := range rec {
+		fields[i] = []byte(strings.TrimSpace(f))
 	}
+	return p.parseFields(fields)
+}
 
-	tsStr := strings.TrimSpace(rec[0])
-	host := strings.TrimSpace(rec[1])
-	disk := strings.TrimSpace(rec[2])
-	typ := strings.TrimSpace(rec[3])
-	offsetStr := strings.TrimSpace(rec[4])
-	sizeStr := strings.TrimSpace(rec[5])
-
-	offset, _ := strconv.ParseInt(offsetStr, 10, 64)
-	size, _ := strconv.ParseInt(sizeStr, 10, 64)
+// parseFields 解析已切分并去掉空白的字段
+func (p *Parser) parseFields(rec [][]byte) (trace.IORecord, error) {
+	if len(rec) < 7 {
+		return trace.IORecord{}, trace.Errorf("expected at least 7 columns, got %d", len(rec))
+	}
+	if bytes.EqualFold(rec[0], []byte("Timestamp")) {
+		return trace.IORecord{}, trace.HeaderError()
+	}
 
-	ft, err := strconv.ParseInt(tsStr, 10, 64)
+	ft, err := trace.ParseInt(rec[0])
+	if err != nil {
+		return trace.IORecord{}, trace.FieldError("Timestamp", string(rec[0]), err)
+	}
+	offset, err := trace.ParseInt(rec[4])
 	if err != nil {
-		return time.Time{}, "", "", 0, 0, false
+		return trace.IORecord{}, trace.FieldError("Offset", string(rec[4]), err)
 	}
+	size, err := trace.ParseInt(rec[5])
+	if err != nil {
+		return trace.IORecord{}, trace.FieldError("Size", string(rec[5]), err)
+	}
+
+	// ResponseTime 同样以 100ns 为单位；无法解析时仍保留该记录，只是不计入延迟统计
+	rt, err := trace.ParseInt(rec[6])
+	hasLatency := err == nil
+
 	const winEpochDiffSeconds = 11644473600
 	secs := ft / 10000000
 	nanos := (ft % 10000000) * 100
 	ts := time.Unix(secs-winEpochDiffSeconds, nanos).UTC().Local()
 
-	volID := host + "-" + disk
-	return ts, typ, volID, offset, size, true
+	// Volume 为 host-disk，Host 直接取其前缀，省一次分配
+	host := rec[1]
+	volume := string(host) + "-" + string(rec[2])
+	return trace.IORecord{
+		Timestamp:  ts,
+		Op:         trace.ParseOpBytes(rec[3]),
+		Volume:     volume,
+		Offset:     offset,
+		Length:     size,
+		Latency:    time.Duration(rt) * 100,
+		HasLatency: hasLatency,
+		Host:       volume[:len(host)],
+	}, nil
 }
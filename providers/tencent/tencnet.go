@@ -2,35 +2,71 @@ package tencent
 
 import (
 	"encoding/csv"
-	"strconv"
 	"strings"
 	"time"
+
+	"ana/trace"
 )
 
 type Parser struct{}
 
 func NewParser() *Parser { return &Parser{} }
 
-func (p *Parser) Parse(line string) (time.Time, string, string, int64, int64, bool) {
+// Parse 解析一行腾讯 CBS trace: Timestamp(s),Offset,Size,IOType,VolumeID
+func (p *Parser) Parse(line string) (trace.IORecord, error) {
+	return p.ParseBytes([]byte(line))
+}
+
+// ParseBytes 与 Parse 相同但直接处理 []byte；无引号的行走零分配切分，
+// 只有 Volume 需要拷贝成字符串，line 在返回后即可复用
+func (p *Parser) ParseBytes(line []byte) (trace.IORecord, error) {
+	var buf [8][]byte
+	rec, ok := trace.SplitFields(line, buf[:0])
+	if !ok || len(line) == 0 {
+		return p.ParseCSV(string(line))
+	}
+	return p.parseFields(rec)
+}
+
+// ParseCSV 用 encoding/csv 解析一行，处理带引号的字段
+func (p *Parser) ParseCSV(line string) (trace.IORecord, error) {
 	r := csv.NewReader(strings.NewReader(line))
 	r.FieldsPerRecord = -1
 	rec, err := r.Read()
-	if err != nil || len(rec) < 5 {
-		return time.Time{}, "", "", 0, 0, false
+	if err != nil {
+		return trace.IORecord{}, &trace.ParseError{Reason: "malformed csv", Err: err}
 	}
-	tsStr := strings.TrimSpace(rec[0])
-	offsetStr := strings.TrimSpace(rec[1])
-	sizeStr := strings.TrimSpace(rec[2])
-	ioType := strings.TrimSpace(rec[3])
-	volID := strings.TrimSpace(rec[4])
-
-	offset, _ := strconv.ParseInt(offsetStr, 10, 64)
-	size, _ := strconv.ParseInt(sizeStr, 10, 64)
+	fields := make([][]byte, len(rec))
+	for i, f := range rec {
+		fields[i] = []byte(strings.TrimSpace(f))
+	}
+	return p.parseFields(fields)
+}
 
-	tsInt, err := strconv.ParseInt(tsStr, 10, 64)
+// parseFields 解析已切分并去掉空白的字段
+func (p *Parser) parseFields(rec [][]byte) (trace.IORecord, error) {
+	if len(rec) < 5 {
+		return trace.IORecord{}, trace.Errorf("expected at least 5 columns, got %d", len(rec))
+	}
+	tsInt, err := trace.ParseInt(rec[0])
+	if err != nil {
+		return trace.IORecord{}, trace.FieldError("timestamp", string(rec[0]), err)
+	}
+	offset, err := trace.ParseInt(rec[1])
+	if err != nil {
+		return trace.IORecord{}, trace.FieldError("offset", string(rec[1]), err)
+	}
+	size, err := trace.ParseInt(rec[2])
 	if err != nil {
-		return time.Time{}, "", "", 0, 0, false
+		return trace.IORecord{}, trace.FieldError("size", string(rec[2]), err)
 	}
+
 	ts := time.Unix(tsInt, 0).UTC().Local()
-	return ts, ioType, volID, offset, size, true
+	return trace.IORecord{
+		Timestamp: ts,
+		Op:        trace.ParseOpBytes(rec[3]),
+		Volume:    string(rec[4]),
+		Offset:    offset,
+		Length:    size,
+	}, nil
 }
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"container/heap"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"ana/cachesim"
+	"ana/trace"
+)
+
+// fenwick 树状数组，用于按访问时间统计仍在 LRU 栈中的 key 数
+type fenwick []int32
+
+func (f fenwick) add(i int, d int32) {
+	for i++; i < len(f); i += i & -i {
+		f[i] += d
+	}
+}
+
+// sum 返回 [0, i) 的前缀和
+func (f fenwick) sum(i int) int32 {
+	var s int32
+	for ; i > 0; i -= i & -i {
+		s += f[i]
+	}
+	return s
+}
+
+// maxKeyHeap 按 key 值的大根堆，SHARDS 固定内存模式下用于淘汰哈希最大的 key
+type maxKeyHeap []uint64
+
+func (h maxKeyHeap) Len() int           { return len(h) }
+func (h maxKeyHeap) Less(i, j int) bool { return h[i] > h[j] }
+func (h maxKeyHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *maxKeyHeap) Push(x any)        { *h = append(*h, x.(uint64)) }
+func (h *maxKeyHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// reuse distance 按 2 的幂分桶：桶 0 为距离 0，桶 b 为 [2^(b-1), 2^b)
+const reuseBuckets = 48
+
+// reuseTracker 使用 SHARDS 空间哈希采样计算 LRU 栈距离直方图。
+// 只处理哈希值小于 threshold 的 key（采样率 threshold/2^64）；
+// 跟踪的 key 超过 maxKeys 时降低 threshold 并按新旧采样率之比缩放直方图，从而保证内存有界。
+type reuseTracker struct {
+	threshold uint64
+	maxKeys   int
+
+	last map[uint64]int // key -> 最近一次访问的时间序号
+	tree fenwick
+	now  int
+	keys maxKeyHeap
+
+	hist [reuseBuckets]float64
+	cold float64
+	refs int64 // 实际被采样的访问次数
+}
+
+func newReuseTracker(rate float64, maxKeys int) *reuseTracker {
+	t := &reuseTracker{
+		threshold: rateToThreshold(rate),
+		maxKeys:   maxKeys,
+		last:      make(map[uint64]int),
+	}
+	t.tree = make(fenwick, 1024)
+	return t
+}
+
+func rateToThreshold(rate float64) uint64 {
+	if rate >= 1 || rate <= 0 {
+		return math.MaxUint64
+	}
+	return uint64(rate * math.MaxUint64)
+}
+
+func (t *reuseTracker) rate() float64 {
+	return float64(t.threshold) / math.MaxUint64
+}
+
+func reuseBucket(d float64) int {
+	if d < 1 {
+		return 0
+	}
+	b := bits.Len64(uint64(d))
+	if b >= reuseBuckets {
+		return reuseBuckets - 1
+	}
+	return b
+}
+
+func (t *reuseTracker) access(key uint64) {
+	if key >= t.threshold {
+		return
+	}
+	t.refs++
+	if prev, ok := t.last[key]; ok {
+		// 栈距离 = prev 之后访问过的不同 key 数
+		d := t.tree.sum(t.now) - t.tree.sum(prev+1)
+		t.tree.add(prev, -1)
+		t.hist[reuseBucket(float64(d)/t.rate())]++
+	} else {
+		t.cold++
+		heap.Push(&t.keys, key)
+	}
+	if t.now+1 >= len(t.tree) {
+		t.compact()
+	}
+	t.last[key] = t.now
+	t.tree.add(t.now, 1)
+	t.now++
+
+	for len(t.last) > t.maxKeys {
+		t.lowerThreshold()
+	}
+}
+
+// lowerThreshold 淘汰哈希最大的 key，并将已有计数按新采样率缩放
+func (t *reuseTracker) lowerThreshold() {
+	oldRate := t.rate()
+	top := heap.Pop(&t.keys).(uint64)
+	t.threshold = top
+	t.tree.add(t.last[top], -1)
+	delete(t.last, top)
+	scale := t.rate() / oldRate
+	for i := range t.hist {
+		t.hist[i] *= scale
+	}
+	t.cold *= scale
+}
+
+// compact 将时间序号重新编号为 0..n-1，避免树状数组无限增长
+func (t *reuseTracker) compact() {
+	type kt struct {
+		key uint64
+		at  int
+	}
+	live := make([]kt, 0, len(t.last))
+	for k, at := range t.last {
+		live = append(live, kt{k, at})
+	}
+	sort.Slice(live, func(i, j int) bool { return live[i].at < live[j].at })
+	size := 4*len(live) + 2
+	if size < 1024 {
+		size = 1024
+	}
+	t.tree = make(fenwick, size)
+	for i, e := range live {
+		t.last[e.key] = i
+		t.tree.add(i, 1)
+	}
+	t.now = len(live)
+}
+
+// reuseResult 是某个 tracker 在输出时刻的快照
+type reuseResult struct {
+	scope string
+	rate  float64
+	refs  int64
+	hist  [reuseBuckets]float64
+	cold  float64
+}
+
+func (t *reuseTracker) snapshot(scope string) reuseResult {
+	return reuseResult{scope: scope, rate: t.rate(), refs: t.refs, hist: t.hist, cold: t.cold}
+}
+
+// cacheStats 是 cache 子命令的分析器：按卷和全局计算 reuse distance 与 miss ratio curve
+type cacheStats struct {
+	mu        sync.Mutex
+	blockSize int64
+	rate      float64
+	maxKeys   int
+
+	global *reuseTracker
+	volMap map[string]*reuseTracker
+	volKey map[string]uint64
+
+	// 策略回放模拟，sims 为空表示未启用
+	sims       []*cachesim.Instance
+	bucketFmt  string // 时间桶的 time.Format 布局
+	writeModes []string
+}
+
+func newCacheStats(blockSize int64, rate float64, maxKeys int) *cacheStats {
+	return &cacheStats{
+		blockSize: blockSize,
+		rate:      rate,
+		maxKeys:   maxKeys,
+		global:    newReuseTracker(rate, maxKeys),
+		volMap:    make(map[string]*reuseTracker),
+		volKey:    make(map[string]uint64),
+	}
+}
+
+// blockKey 将 (卷, block) 映射为均匀分布的 64 位 key，作为 SHARDS 的空间哈希
+func blockKey(volHash uint64, block int64) uint64 {
+	return mix64(volHash ^ mix64(uint64(block)))
+}
+
+func (cs *cacheStats) observe(rec *trace.IORecord) {
+	if rec.Length <= 0 {
+		return
+	}
+	startBlock, endBlock := blockRange(rec.Offset, rec.Length, cs.blockSize)
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	vh, ok := cs.volKey[rec.Volume]
+	if !ok {
+		h := fnv.New64a()
+		h.Write([]byte(rec.Volume))
+		vh = h.Sum64()
+		cs.volKey[rec.Volume] = vh
+		cs.volMap[rec.Volume] = newReuseTracker(cs.rate, cs.maxKeys)
+	}
+	vt := cs.volMap[rec.Volume]
+	var bucket string
+	if len(cs.sims) > 0 {
+		bucket = rec.Timestamp.Format(cs.bucketFmt)
+	}
+	for b := startBlock; b <= endBlock; b++ {
+		key := blockKey(vh, b)
+		cs.global.access(key)
+		vt.access(key)
+		if len(cs.sims) > 0 {
+			// 请求落在该 block 内的字节数
+			lo := max(rec.Offset, b*cs.blockSize)
+			hi := min(rec.Offset+rec.Length, (b+1)*cs.blockSize)
+			for _, in := range cs.sims {
+				in.Access(bucket, key, hi-lo, rec.IsWrite())
+			}
+		}
+	}
+}
+
+// setSimulation 为每个 (策略, 容量) 组合创建一个回放实例
+func (cs *cacheStats) setSimulation(policies []string, sizes []int64, bucketFmt string, writeModes []string) error {
+	for _, name := range policies {
+		for _, size := range sizes {
+			p, err := cachesim.New(name, int(size/cs.blockSize))
+			if err != nil {
+				return err
+			}
+			cs.sims = append(cs.sims, cachesim.NewInstance(p, size, cs.blockSize))
+		}
+	}
+	cs.bucketFmt = bucketFmt
+	cs.writeModes = writeModes
+	return nil
+}
+
+// writeCacheCSVs 输出 reuse_distance_hist.csv 与 mrc.csv（Scope=ALL 为全局）
+func writeCacheCSVs(outDir string, ag *Aggregator) error {
+	cs := ag.cache
+	cs.mu.Lock()
+	results := []reuseResult{cs.global.snapshot("ALL")}
+	vols := make([]string, 0, len(cs.volMap))
+	for v := range cs.volMap {
+		vols = append(vols, v)
+	}
+	sort.Strings(vols)
+	for _, v := range vols {
+		results = append(results, cs.volMap[v].snapshot(v))
+	}
+	blockSize := cs.blockSize
+	cs.mu.Unlock()
+
+	histHeader := []string{"Scope", "DistanceBlocks", "EstimatedRefs"}
+	mrcHeader := []string{"Scope", "CacheBlocks", "CacheBytes", "MissRatio", "SampleRate", "SampledRefs"}
+	var histRows, mrcRows [][]string
+	for _, r := range results {
+		if r.refs == 0 {
+			continue
+		}
+		total := r.cold
+		last := 0
+		for i, c := range r.hist {
+			total += c
+			if c > 0 {
+				last = i
+			}
+		}
+		histRows = append(histRows, []string{r.scope, "cold", strconv.FormatFloat(r.cold/r.rate, 'f', 0, 64)})
+		for i := 0; i <= last; i++ {
+			lo := int64(0)
+			if i > 0 {
+				lo = int64(1) << (i - 1)
+			}
+			histRows = append(histRows, []string{r.scope, strconv.FormatInt(lo, 10), strconv.FormatFloat(r.hist[i]/r.rate, 'f', 0, 64)})
+		}
+		// 容量为 2^k 个 block 的 LRU 缓存命中距离 < 2^k 的访问，即桶 0..k
+		var hits float64
+		for k := 0; k <= last; k++ {
+			hits += r.hist[k]
+			cacheBlocks := int64(1) << k
+			mrcRows = append(mrcRows, []string{
+				r.scope,
+				strconv.FormatInt(cacheBlocks, 10),
+				strconv.FormatInt(cacheBlocks*blockSize, 10),
+				strconv.FormatFloat(1-hits/total, 'f', 6, 64),
+				strconv.FormatFloat(r.rate, 'g', 6, 64),
+				strconv.FormatInt(r.refs, 10),
+			})
+		}
+	}
+	if err := writeCSV(filepath.Join(outDir, "reuse_distance_hist.csv"), histHeader, histRows); err != nil {
+		return err
+	}
+	if err := writeCSV(filepath.Join(outDir, "mrc.csv"), mrcHeader, mrcRows); err != nil {
+		return err
+	}
+	return writeCacheSimCSVs(outDir, cs)
+}
+
+func formatRatio(part, total int64) string {
+	if total == 0 {
+		return "0"
+	}
+	return strconv.FormatFloat(float64(part)/float64(total), 'f', 6, 64)
+}
+
+// cacheSimRow 生成一行模拟结果；wb 模式的后端写流量为脏块淘汰，wt 模式为全部写入
+func cacheSimRow(prefix []string, c *cachesim.Counters, mode string) []string {
+	backendWrite := c.WriteBytes
+	if mode == "wb" {
+		backendWrite = c.WriteBack
+	}
+	return append(prefix,
+		mode,
+		strconv.FormatInt(c.Accesses, 10),
+		strconv.FormatInt(c.Hits, 10),
+		formatRatio(c.Hits, c.Accesses),
+		formatRatio(c.HitBytes, c.Bytes),
+		strconv.FormatInt(c.ReadMissByte, 10),
+		strconv.FormatInt(backendWrite, 10),
+	)
+}
+
+// writeCacheSimCSVs 输出 cache_sim.csv（按时间桶）与 cache_sim_summary.csv
+func writeCacheSimCSVs(outDir string, cs *cacheStats) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if len(cs.sims) == 0 {
+		return nil
+	}
+	tail := []string{"Mode", "Accesses", "Hits", "HitRatio", "ByteHitRatio", "BackendReadBytes", "BackendWriteBytes"}
+	header := append([]string{"Policy", "CacheBytes", "Bucket"}, tail...)
+	sumHeader := append([]string{"Policy", "CacheBytes"}, tail...)
+	sumHeader = append(sumHeader, "DirtyBytesAtEnd")
+	var rows, sumRows [][]string
+	for _, in := range cs.sims {
+		name := in.Policy.Name()
+		size := strconv.FormatInt(in.CapacityBytes, 10)
+		keys := make([]string, 0, len(in.Buckets))
+		for k := range in.Buckets {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		total := &cachesim.Counters{}
+		for _, k := range keys {
+			c := in.Buckets[k]
+			total.Add(c)
+			for _, mode := range cs.writeModes {
+				rows = append(rows, cacheSimRow([]string{name, size, k}, c, mode))
+			}
+		}
+		for _, mode := range cs.writeModes {
+			dirty := "0"
+			if mode == "wb" {
+				dirty = strconv.FormatInt(in.DirtyBytes(), 10)
+			}
+			sumRows = append(sumRows, append(cacheSimRow([]string{name, size}, total, mode), dirty))
+		}
+	}
+	if err := writeCSV(filepath.Join(outDir, "cache_sim.csv"), header, rows); err != nil {
+		return err
+	}
+	return writeCSV(filepath.Join(outDir, "cache_sim_summary.csv"), sumHeader, sumRows)
+}
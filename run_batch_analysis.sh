@@ -63,41 +63,56 @@ for dataset_info in "${DATASETS[@]}"; do
     echo "  Volume:   $VOL_ID"
     echo "----------------------------------------------------------------"
 
-    # 遍历 EC 策略
+    # 所有 EC 策略与块大小在一次读取中完成，结果写入 ${OUT_DIR}/${EC_LABEL}/${size_label}
+    EC_LIST=""
     for ec_conf in "${EC_CONFIGS[@]}"; do
         read -r DATA_BLOCKS PARITY_BLOCKS <<< "$ec_conf"
-        EC_LABEL="${DATA_BLOCKS}+${PARITY_BLOCKS}"
-
-        # 遍历块大小
-        for size_label in "${!BLOCK_SIZES[@]}"; do
-            SIZE_BYTES="${BLOCK_SIZES[$size_label]}"
-            
-            # 构建特定输出目录
-            OUT_DIR="${BASE_OUT_DIR}/${NAME}/${EC_LABEL}/${size_label}"
-            mkdir -p "$OUT_DIR"
-
-            echo "  [Running] EC: $EC_LABEL, BlockSize: $size_label ($SIZE_BYTES bytes)"
-            echo "    -> Output: $OUT_DIR"
-
-             # 构造命令字符串
-            CMD="./bin/ana -d \"$DIR\" -provider \"$PROVIDER\" -from \"$FROM\" -to \"$TO\" -target_vol \"$VOL_ID\" -data_blocks \"$DATA_BLOCKS\" -parity_blocks \"$PARITY_BLOCKS\" -stripe_block_size \"$SIZE_BYTES\" -o \"$OUT_DIR\""
-            
-            # 打印实际执行的命令
-            echo "    -> Executing: $CMD"
-
-            # 执行命令
-            # 注意：使用 eval 执行构造的命令字符串，以正确处理引号
-            eval "$CMD > \"${OUT_DIR}/analysis.log\" 2>&1"
-
-            if [ $? -eq 0 ]; then
-                echo "    [Success]"
-            else
-                echo "    [Failed] Check logs in ${OUT_DIR}/analysis.log"
-                # 根据需求决定是否退出，这里选择继续执行下一个
-                # exit 1 
-            fi
-        done
+        EC_LIST="${EC_LIST:+${EC_LIST},}${DATA_BLOCKS}+${PARITY_BLOCKS}"
+    done
+    SIZE_LIST=""
+    for size_label in "${!BLOCK_SIZES[@]}"; do
+        SIZE_LIST="${SIZE_LIST:+${SIZE_LIST},}${BLOCK_SIZES[$size_label]}"
     done
+
+    OUT_DIR="${BASE_OUT_DIR}/${NAME}"
+    mkdir -p "$OUT_DIR"
+
+    echo "  [Running] EC: $EC_LIST, BlockSizes: $SIZE_LIST"
+    echo "    -> Output: $OUT_DIR/<EC>/<BlockSize> (每个配置目录包含完整输出)"
+
+    # 构造命令字符串
+    CMD="./bin/ana -d \"$DIR\" -provider \"$PROVIDER\" -from \"$FROM\" -to \"$TO\" -target_vol \"$VOL_ID\" -ec_configs \"$EC_LIST\" -stripe_block_sizes \"$SIZE_LIST\" -o \"$OUT_DIR\""
+
+    # 打印实际执行的命令
+    echo "    -> Executing: $CMD"
+
+    # 执行命令
+    # 注意：使用 eval 执行构造的命令字符串，以正确处理引号
+    if eval "$CMD > \"${OUT_DIR}/analysis.log\" 2>&1"; then
+        echo "    [Success]"
+        # 一次运行中 time_stats/volume/minute 及 volume_stats_minute/ 等与配置无关的输出写在 ${OUT_DIR} 顶层，
+        # 这里把它们链接（跨文件系统时复制）到每个 <EC>/<BlockSize> 目录，
+        # 保持每个配置目录都有完整输出，与逐配置运行时的目录结构一致
+        for ec_conf in "${EC_CONFIGS[@]}"; do
+            read -r DATA_BLOCKS PARITY_BLOCKS <<< "$ec_conf"
+            for size_label in "${!BLOCK_SIZES[@]}"; do
+                CFG_DIR="${OUT_DIR}/${DATA_BLOCKS}+${PARITY_BLOCKS}/${size_label}"
+                mkdir -p "$CFG_DIR"
+                find "$OUT_DIR" -maxdepth 1 -type f -print0 | while IFS= read -r -d '' f; do
+                    ln -f "$f" "$CFG_DIR/" 2>/dev/null || cp -f "$f" "$CFG_DIR/"
+                done
+                if [ -d "${OUT_DIR}/volume_stats_minute" ]; then
+                    rm -rf "${CFG_DIR}/volume_stats_minute"
+                    cp -al "${OUT_DIR}/volume_stats_minute" "$CFG_DIR/" 2>/dev/null \
+                        || cp -R "${OUT_DIR}/volume_stats_minute" "$CFG_DIR/"
+                fi
+            done
+        done
+    else
+        echo "    [Failed] Check logs in ${OUT_DIR}/analysis.log"
+        # 根据需求决定是否退出，这里选择继续执行下一个
+        # exit 1
+    fi
 done
 
 echo "Batch analysis completed."
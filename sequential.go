@@ -0,0 +1,211 @@
+package main
+
+import (
+	"math/bits"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"ana/trace"
+)
+
+// seqStream 记录一个正在跟踪的顺序/跨步访问流
+type seqStream struct {
+	next    int64 // 顺序访问时期望的下一个 offset
+	last    int64 // 最近一次访问的 offset
+	stride  int64 // 最近一次跳转的步长，0 表示尚未形成跨步
+	ios     int64
+	bytes   int64
+	lastUse int64
+}
+
+// 随机跳转距离分桶（按 16 倍递增）: <=4K, <=64K, <=1M, <=16M, <=256M, <=4G, <=64G, >64G
+var jumpBucketLabels = []string{"<=4K", "<=64K", "<=1M", "<=16M", "<=256M", "<=4G", "<=64G", ">64G"}
+
+func jumpBucket(dist int64) int {
+	if dist <= 4096 {
+		return 0
+	}
+	b := (bits.Len64(uint64(dist-1)) - 12 + 3) / 4
+	if b >= len(jumpBucketLabels) {
+		return len(jumpBucketLabels) - 1
+	}
+	return b
+}
+
+// volSeqStats 单个卷、单个方向（读或写）的顺序性统计
+type volSeqStats struct {
+	streams  []seqStream
+	ios      int64
+	seqIOs   int64
+	strided  int64
+	runs     int64
+	runBytes int64
+	jumps    [8]int64
+}
+
+func (vs *volSeqStats) endRun(s *seqStream) {
+	if s.ios >= 2 {
+		vs.runs++
+		vs.runBytes += s.bytes
+	}
+}
+
+// seqStats 按卷检测顺序流与跨步流，每卷每个方向同时跟踪 maxStreams 个流。
+// 只由 observeShared 调用，各批次经 batchGate 依次进入，不需要加锁
+type seqStats struct {
+	maxStreams   int
+	strideWindow int64
+	tick         int64
+	volMap       map[string]*[2]volSeqStats
+}
+
+func newSeqStats(maxStreams int, strideWindow int64) *seqStats {
+	ss := &seqStats{
+		maxStreams:   8,
+		strideWindow: 1 << 20,
+		volMap:       make(map[string]*[2]volSeqStats),
+	}
+	if maxStreams > 0 {
+		ss.maxStreams = maxStreams
+	}
+	if strideWindow >= 0 {
+		ss.strideWindow = strideWindow
+	}
+	return ss
+}
+
+func (ss *seqStats) observe(rec *trace.IORecord) {
+	off, length := rec.Offset, rec.Length
+	ss.tick++
+	pair, ok := ss.volMap[rec.Volume]
+	if !ok {
+		pair = &[2]volSeqStats{}
+		ss.volMap[rec.Volume] = pair
+	}
+	vs := &pair[rec.Op]
+	vs.ios++
+
+	// 1. 顺序：正好接在某个流之后
+	for i := range vs.streams {
+		s := &vs.streams[i]
+		if off == s.next {
+			vs.seqIOs++
+			s.last, s.next = off, off+length
+			s.ios++
+			s.bytes += length
+			s.lastUse = ss.tick
+			return
+		}
+	}
+	// 2. 跨步：与某个流上一次的跳转步长相同
+	for i := range vs.streams {
+		s := &vs.streams[i]
+		if s.stride != 0 && off-s.last == s.stride {
+			vs.strided++
+			s.last, s.next = off, off+length
+			s.ios++
+			s.bytes += length
+			s.lastUse = ss.tick
+			return
+		}
+	}
+	// 3. 随机：记录到最近流的跳转距离，窗口内的跳转并入该流作为候选步长
+	nearest := -1
+	var nearestDist int64
+	for i := range vs.streams {
+		d := off - vs.streams[i].next
+		if d < 0 {
+			d = -d
+		}
+		if nearest < 0 || d < nearestDist {
+			nearest, nearestDist = i, d
+		}
+	}
+	if nearest >= 0 {
+		vs.jumps[jumpBucket(nearestDist)]++
+		if nearestDist <= ss.strideWindow {
+			s := &vs.streams[nearest]
+			last := s.last
+			if s.stride != 0 {
+				// 步长被打断，之前的流视为一次 run 结束
+				vs.endRun(s)
+				*s = seqStream{}
+			}
+			s.stride = off - last
+			s.last, s.next = off, off+length
+			s.ios++
+			s.bytes += length
+			s.lastUse = ss.tick
+			return
+		}
+	}
+	ns := seqStream{next: off + length, last: off, ios: 1, bytes: length, lastUse: ss.tick}
+	if len(vs.streams) < ss.maxStreams {
+		vs.streams = append(vs.streams, ns)
+		return
+	}
+	lru := 0
+	for i := range vs.streams {
+		if vs.streams[i].lastUse < vs.streams[lru].lastUse {
+			lru = i
+		}
+	}
+	vs.endRun(&vs.streams[lru])
+	vs.streams[lru] = ns
+}
+
+// writeSequentialCSVs 输出 sequential_stats.csv 与 sequential_jump_hist.csv，未启用时不输出
+func writeSequentialCSVs(outDir string, ag *Aggregator) error {
+	ss := ag.seq
+	if ss == nil {
+		return nil
+	}
+	vols := make([]string, 0, len(ss.volMap))
+	for vol, pair := range ss.volMap {
+		vols = append(vols, vol)
+		for op := range pair {
+			vs := &pair[op]
+			// 仍在跟踪中的流也计入 run
+			for i := range vs.streams {
+				vs.endRun(&vs.streams[i])
+			}
+			vs.streams = nil
+		}
+	}
+	sort.Strings(vols)
+
+	header := []string{"VolumeID",
+		"Reads", "SeqReads", "StridedReads", "SeqRead(%)",
+		"Writes", "SeqWrites", "StridedWrites", "SeqWrite(%)",
+		"Runs", "AvgRunBytes"}
+	rows := make([][]string, 0, len(vols))
+	jumpHeader := []string{"VolumeID", "Op"}
+	jumpHeader = append(jumpHeader, jumpBucketLabels...)
+	jumpRows := make([][]string, 0, 2*len(vols))
+	for _, vol := range vols {
+		pair := ss.volMap[vol]
+		r, w := &pair[trace.OpRead], &pair[trace.OpWrite]
+		runs := r.runs + w.runs
+		avgRun := "0"
+		if runs > 0 {
+			avgRun = strconv.FormatInt((r.runBytes+w.runBytes)/runs, 10)
+		}
+		rows = append(rows, []string{vol,
+			strconv.FormatInt(r.ios, 10), strconv.FormatInt(r.seqIOs, 10), strconv.FormatInt(r.strided, 10), calculateReadRatioPercent(r.seqIOs, r.ios),
+			strconv.FormatInt(w.ios, 10), strconv.FormatInt(w.seqIOs, 10), strconv.FormatInt(w.strided, 10), calculateReadRatioPercent(w.seqIOs, w.ios),
+			strconv.FormatInt(runs, 10), avgRun,
+		})
+		for op := trace.OpRead; op <= trace.OpWrite; op++ {
+			row := []string{vol, op.String()}
+			for _, c := range pair[op].jumps {
+				row = append(row, strconv.FormatInt(c, 10))
+			}
+			jumpRows = append(jumpRows, row)
+		}
+	}
+	if err := writeCSV(filepath.Join(outDir, "sequential_stats.csv"), header, rows); err != nil {
+		return err
+	}
+	return writeCSV(filepath.Join(outDir, "sequential_jump_hist.csv"), jumpHeader, jumpRows)
+}
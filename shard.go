@@ -0,0 +1,218 @@
+package main
+
+import (
+	"time"
+
+	"ana/trace"
+)
+
+// localFlushEvery 是 worker 本地累加多少条记录后合并一次到全局
+const localFlushEvery = 8192
+
+// localAggregator 是单个 parser worker 私有的计数分片：天/小时/分钟/分钟×卷/卷计数以及
+// IO 大小、延迟直方图都先在本地无竞争地累加，定期（以及通道暂空、结束时）合并到 Aggregator，
+// 每次合并每个全局 map 只加一次锁。依赖记录顺序的分析器不能分片：add 只把记录缓存在 ordered 中，
+// worker 按批次序号通过 batchGate 后再由 observeOrdered 依次交给 observeShared。
+type localAggregator struct {
+	ag *Aggregator
+
+	dayMap       map[string]*CountPair
+	hourMap      map[string]*CountPair
+	minuteMap    map[string]*CountPair
+	minuteVolMap map[string]map[string]*CountPair
+	volMap       map[string]*CountPair
+	firstTs      time.Time
+	lastTs       time.Time
+
+	latency *latencyStats
+	ioSize  *ioSizeStats
+
+	pending int
+	ordered []orderedRecord // 当前批次中待交给顺序相关分析器的记录
+
+	// 同一秒内的记录复用时间 key，避免每条记录都格式化三次
+	keySec int64
+	keyLoc *time.Location
+	keys   recordKeys
+}
+
+func (ag *Aggregator) newLocal() *localAggregator {
+	return &localAggregator{
+		ag:           ag,
+		dayMap:       make(map[string]*CountPair),
+		hourMap:      make(map[string]*CountPair),
+		minuteMap:    make(map[string]*CountPair),
+		minuteVolMap: make(map[string]map[string]*CountPair),
+		volMap:       make(map[string]*CountPair),
+		latency:      newLatencyStats(),
+		ioSize:       newIOSizeStats(),
+		keySec:       -1,
+	}
+}
+
+func countIn(m map[string]*CountPair, key string) *CountPair {
+	cp, ok := m[key]
+	if !ok {
+		cp = &CountPair{}
+		m[key] = cp
+	}
+	return cp
+}
+
+func (l *localAggregator) add(rec *trace.IORecord) {
+	ag := l.ag
+	ts := rec.Timestamp
+	if !ag.accept(ts) {
+		return
+	}
+	if ag.cache != nil {
+		l.ordered = append(l.ordered, orderedRecord{rec: *rec})
+		return
+	}
+	if sec := ts.Unix(); sec != l.keySec || ts.Location() != l.keyLoc {
+		l.keySec, l.keyLoc = sec, ts.Location()
+		l.keys = makeRecordKeys(ts)
+	}
+	k := &l.keys
+	l.ordered = append(l.ordered, orderedRecord{rec: *rec, keys: *k})
+	if rec.HasLatency {
+		l.latency.observe(rec, k.minute)
+	}
+	l.ioSize.observe(rec, k.hour)
+
+	isRead, size := rec.IsRead(), rec.Length
+	countIn(l.dayMap, k.day).add(isRead, size)
+	countIn(l.hourMap, k.hour).add(isRead, size)
+	countIn(l.minuteMap, k.minute).add(isRead, size)
+	if ag.enableMinuteVolume {
+		mv, ok := l.minuteVolMap[k.minute]
+		if !ok {
+			mv = make(map[string]*CountPair)
+			l.minuteVolMap[k.minute] = mv
+		}
+		countIn(mv, rec.Volume).add(isRead, size)
+	}
+	countIn(l.volMap, rec.Volume).add(isRead, size)
+	if l.firstTs.IsZero() || ts.Before(l.firstTs) {
+		l.firstTs = ts
+	}
+	if ts.After(l.lastTs) {
+		l.lastTs = ts
+	}
+	l.pending++
+}
+
+// orderedRecord 是等待按批次顺序处理的一条记录及其时间 key
+type orderedRecord struct {
+	rec  trace.IORecord
+	keys recordKeys
+}
+
+// observeOrdered 把缓存的记录依次交给顺序相关的分析器，调用方需已通过 batchGate
+func (l *localAggregator) observeOrdered() {
+	ag := l.ag
+	for i := range l.ordered {
+		r := &l.ordered[i]
+		if ag.cache != nil {
+			ag.cache.observe(&r.rec)
+		} else {
+			ag.observeShared(&r.rec, &r.keys)
+		}
+	}
+	clear(l.ordered)
+	l.ordered = l.ordered[:0]
+}
+
+// mergeCounts 把 src 合并进 dst；dst 中没有的 key 直接接管 src 的对象
+func mergeCounts(dst, src map[string]*CountPair) {
+	for k, v := range src {
+		if d, ok := dst[k]; ok {
+			d.merge(v)
+		} else {
+			dst[k] = v
+		}
+	}
+}
+
+// flush 将本地分片合并到全局并清空
+func (l *localAggregator) flush() {
+	ag := l.ag
+	if l.pending == 0 {
+		return
+	}
+
+	ag.dayMu.Lock()
+	mergeCounts(ag.dayMap, l.dayMap)
+	ag.dayMu.Unlock()
+
+	ag.hourMu.Lock()
+	mergeCounts(ag.hourMap, l.hourMap)
+	ag.hourMu.Unlock()
+
+	ag.minuteMu.Lock()
+	mergeCounts(ag.minuteMap, l.minuteMap)
+	ag.minuteMu.Unlock()
+
+	if len(l.minuteVolMap) > 0 {
+		type evicted struct {
+			key   string
+			mv    map[string]*CountPair
+			again bool
+		}
+		var out []evicted
+		ag.minuteVolMu.Lock()
+		for minuteKey, src := range l.minuteVolMap {
+			mv, ok := ag.minuteVolMap[minuteKey]
+			if !ok {
+				ag.minuteVolMap[minuteKey] = src
+				ag.minuteOrder = append(ag.minuteOrder, minuteKey)
+			} else {
+				mergeCounts(mv, src)
+			}
+			for ag.minuteBufLimit > 0 && len(ag.minuteOrder) > ag.minuteBufLimit {
+				key := ag.minuteOrder[0]
+				out = append(out, evicted{key, ag.minuteVolMap[key], ag.evictedMinutes[key]})
+				ag.evictedMinutes[key] = true
+				delete(ag.minuteVolMap, key)
+				ag.minuteOrder = ag.minuteOrder[1:]
+			}
+		}
+		// 在释放 minuteVolMu 之前取得 evictMu：同一分钟的多次淘汰按发生顺序写出，后一次能合并前一次的结果
+		if len(out) > 0 {
+			ag.evictMu.Lock()
+		}
+		ag.minuteVolMu.Unlock()
+		if len(out) > 0 {
+			if ag.onEvict != nil {
+				for _, e := range out {
+					ag.onEvict(e.key, e.mv, e.again)
+				}
+			}
+			ag.evictMu.Unlock()
+		}
+	}
+
+	ag.volMu.Lock()
+	mergeCounts(ag.volMap, l.volMap)
+	if ag.firstTs.IsZero() || l.firstTs.Before(ag.firstTs) {
+		ag.firstTs = l.firstTs
+	}
+	if l.lastTs.After(ag.lastTs) {
+		ag.lastTs = l.lastTs
+	}
+	ag.volMu.Unlock()
+
+	ag.latency.merge(l.latency)
+	ag.ioSize.merge(l.ioSize)
+
+	// 合并后对象已归全局所有，本地重新分配
+	clear(l.dayMap)
+	clear(l.hourMap)
+	clear(l.minuteMap)
+	clear(l.minuteVolMap)
+	clear(l.volMap)
+	l.firstTs, l.lastTs = time.Time{}, time.Time{}
+	l.latency = newLatencyStats()
+	l.ioSize = newIOSizeStats()
+	l.pending = 0
+}
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ana/trace"
+)
+
+type StripeOperation struct {
+	StripeID   int64
+	BlockIndex int
+	BlockType  string // "Data" or "Parity"
+	ReadWrite  string // "Read" or "Write"
+	Disk       int    // 物理磁盘编号，由布局决定
+	OptionTime time.Time
+	IO         uint64 // 所属逻辑 IO 在该条带状态中的序号，用于区分同一时间戳的不同请求
+}
+
+// StripeConfig 描述一种 EC 条带配置
+type StripeConfig struct {
+	BlockSize     int64
+	DataBlocks    int
+	ParityBlocks  int    // RS 的校验块数；LRC 下为全局校验块数 r
+	LocalParities int    // LRC 的本地组数 l（每组一个本地校验），0 表示 RS
+	Layout        string // dedicated|rotated|declustered
+	Disks         int    // declustered 布局下的模拟磁盘数
+	Placement     Placement
+	Failure       *FailureSpec // nil 表示不模拟故障
+}
+
+// ECLabel 返回 "Data+Parity"（LRC 为 "Data+Local+Global"），与 run_batch_analysis.sh 的目录名一致
+func (c StripeConfig) ECLabel() string {
+	if c.isLRC() {
+		return fmt.Sprintf("%d+%d+%d", c.DataBlocks, c.LocalParities, c.ParityBlocks)
+	}
+	return fmt.Sprintf("%d+%d", c.DataBlocks, c.ParityBlocks)
+}
+
+// SizeLabel 返回块大小标签，如 4KB、1MB
+func (c StripeConfig) SizeLabel() string {
+	switch {
+	case c.BlockSize%(1<<20) == 0:
+		return fmt.Sprintf("%dMB", c.BlockSize>>20)
+	case c.BlockSize%(1<<10) == 0:
+		return fmt.Sprintf("%dKB", c.BlockSize>>10)
+	default:
+		return fmt.Sprintf("%dB", c.BlockSize)
+	}
+}
+
+// Dir 返回该配置的输出子目录 "<EC>/<Size>"
+func (c StripeConfig) Dir() string {
+	return filepath.Join(c.ECLabel(), c.SizeLabel())
+}
+
+// parseECConfigs 解析 "10+4,6+3,12+2+2" 形式的 EC 配置列表，
+// 两段为 RS 的 data+parity，三段为 LRC 的 data+local+global；返回 {data, local, parity}。
+func parseECConfigs(s string) ([][3]int, error) {
+	var out [][3]int
+	for _, item := range splitList(s) {
+		parts := strings.Split(item, "+")
+		if len(parts) != 2 && len(parts) != 3 {
+			return nil, fmt.Errorf("invalid EC config %q, expected data+parity or data+local+global", item)
+		}
+		vals := make([]int, len(parts))
+		for i, p := range parts {
+			v, err := strconv.Atoi(strings.TrimSpace(p))
+			if err != nil || v < 0 {
+				return nil, fmt.Errorf("invalid EC config %q", item)
+			}
+			vals[i] = v
+		}
+		ec := [3]int{vals[0], 0, vals[1]}
+		if len(vals) == 3 {
+			ec = [3]int{vals[0], vals[1], vals[2]}
+			if ec[1] == 0 || ec[1] > ec[0] {
+				return nil, fmt.Errorf("invalid EC config %q, local groups must be in [1, data]", item)
+			}
+		}
+		if ec[0] <= 0 {
+			return nil, fmt.Errorf("invalid EC config %q", item)
+		}
+		out = append(out, ec)
+	}
+	return out, nil
+}
+
+// stripeState 保存单个条带配置下的统计，每个配置独立加锁
+type stripeState struct {
+	cfg StripeConfig
+
+	mu        sync.Mutex
+	updateMap map[int]int // Key: Number of blocks updated (1-10), Value: Count
+
+	// map[StripeID][]CountPair
+	// Index 0-(DataBlocks-1): Data Blocks
+	// Index DataBlocks-(TotalBlocks-1): Parity Blocks（LRC 为本地校验在前、全局校验在后）
+	heatMap map[int64][]CountPair
+	// 与 heatMap 同样索引的设备访问计数，含写代价模型的额外读与校验写，反映各布局下的物理磁盘负载
+	deviceHeat map[int64][]CountPair
+
+	ops   []StripeOperation
+	ioSeq uint64    // 已处理的逻辑 IO 数，作为 ops 的 IO 序号
+	spill *opsSpill // 非 nil 时 ops 超出内存预算后落盘
+
+	costMinute map[string]*stripeCost // key: "01-02 15:04"
+
+	// 每块模拟磁盘上的数据/校验访问次数
+	diskData   []CountPair
+	diskParity []CountPair
+
+	// 节点放置分析，未启用时 placer 为 nil
+	placer     *placer
+	nodeMinute map[string][]CountPair // key: "01-02 15:04" -> 每个节点的负载
+	curNodes   []CountPair            // 当前记录所在分钟的节点负载
+
+	fail *failureState // 故障与修复模拟，未启用时为 nil
+}
+
+func newStripeState(cfg StripeConfig) *stripeState {
+	st := &stripeState{
+		cfg:        cfg,
+		updateMap:  make(map[int]int),
+		heatMap:    make(map[int64][]CountPair),
+		deviceHeat: make(map[int64][]CountPair),
+		ops:        make([]StripeOperation, 0),
+		costMinute: make(map[string]*stripeCost),
+		diskData:   make([]CountPair, cfg.DiskCount()),
+		diskParity: make([]CountPair, cfg.DiskCount()),
+	}
+	if cfg.Placement.Nodes > 0 {
+		st.placer = newPlacer(cfg.Placement, cfg.DiskCount())
+		st.nodeMinute = make(map[string][]CountPair)
+	}
+	if cfg.Failure != nil {
+		st.fail = newFailureState(*cfg.Failure)
+	}
+	return st
+}
+
+// access 记录逻辑 IO 落在条带 stripe 位置 pos 上的一次访问，计入热力图与 stripe_ops（调用方持有 st.mu）。
+// 代价模型产生的额外读与校验写不经过这里，只计入 device。
+func (st *stripeState) access(stripe int64, pos int, isRead bool, ts time.Time) {
+	counters, ok := st.heatMap[stripe]
+	if !ok {
+		counters = make([]CountPair, st.cfg.width())
+		st.heatMap[stripe] = counters
+	}
+	rw := "Write"
+	if isRead {
+		rw = "Read"
+		counters[pos].Reads++
+	} else {
+		counters[pos].Writes++
+	}
+
+	// Record detailed stripe operation
+	st.appendOp(StripeOperation{
+		StripeID:   stripe,
+		BlockIndex: pos,
+		BlockType:  st.cfg.blockType(pos),
+		ReadWrite:  rw,
+		Disk:       st.cfg.disk(stripe, pos),
+		OptionTime: ts,
+		IO:         st.ioSeq,
+	})
+}
+
+// device 记录条带 stripe 位置 pos 所在磁盘/节点上的一次设备访问，包括代价模型产生的额外读与校验写，
+// 同时计入设备热力图 deviceHeat（调用方持有 st.mu）
+func (st *stripeState) device(stripe int64, pos int, isRead bool) {
+	counters, ok := st.deviceHeat[stripe]
+	if !ok {
+		counters = make([]CountPair, st.cfg.width())
+		st.deviceHeat[stripe] = counters
+	}
+	if isRead {
+		counters[pos].Reads++
+	} else {
+		counters[pos].Writes++
+	}
+	disk := st.cfg.disk(stripe, pos)
+	load := &st.diskData[disk]
+	if pos >= st.cfg.DataBlocks {
+		load = &st.diskParity[disk]
+	}
+	if isRead {
+		load.Reads++
+	} else {
+		load.Writes++
+	}
+	if st.placer != nil {
+		st.curNodes[st.placer.node(stripe, disk)].add(isRead, st.cfg.BlockSize)
+	}
+}
+
+// observe 将一次逻辑 IO 展开到各条带：逻辑热力图与 stripe_ops 只记录逻辑 IO 访问的数据块；
+// 设备热力图与磁盘/节点负载记录设备流量，写按代价模型额外读取旧数据/旧校验，并写入数据块与受影响的校验块
+// （RS 为全部校验，LRC 为被写到的本地组的本地校验加全部全局校验）。
+func (st *stripeState) observe(rec *trace.IORecord, minuteKey string) {
+	if rec.Length <= 0 {
+		return
+	}
+	ts := rec.Timestamp
+	isRead := rec.IsRead()
+	k := st.cfg.DataBlocks
+	bs := st.cfg.BlockSize
+	startBlock, endBlock := blockRange(rec.Offset, rec.Length, bs)
+	end := rec.Offset + rec.Length
+
+	var delta stripeCost
+	st.mu.Lock()
+	st.ioSeq++
+	if st.placer != nil {
+		nodes, ok := st.nodeMinute[minuteKey]
+		if !ok {
+			nodes = make([]CountPair, st.cfg.Placement.Nodes)
+			st.nodeMinute[minuteKey] = nodes
+		}
+		st.curNodes = nodes
+	}
+	if st.fail != nil {
+		if s, _ := st.cfg.locate(endBlock); s > st.fail.maxStripe {
+			st.fail.maxStripe = s
+		}
+		st.advanceRepair(ts, minuteKey)
+	}
+	for b := startBlock; b <= endBlock; {
+		stripe, first := st.cfg.locate(b)
+		last := min(k-1, first+int(endBlock-b))
+		w := last - first + 1
+		stripeEndBlock := b + int64(w) - 1
+		b = stripeEndBlock + 1
+
+		if isRead {
+			for pos := first; pos <= last; pos++ {
+				st.readBlock(stripe, pos, ts, minuteKey)
+			}
+			continue
+		}
+
+		st.updateMap[w]++
+
+		// 首尾 block 可能只被部分覆盖（同一个 block 只计一次）
+		firstPartial := rec.Offset > (stripeEndBlock-int64(w)+1)*bs
+		lastPartial := end < (stripeEndBlock+1)*bs
+		partial := 0
+		if firstPartial {
+			partial++
+		}
+		if lastPartial && (w > 1 || !firstPartial) {
+			partial++
+		}
+		local, global := st.cfg.updatedParities(first, last)
+		parities := append(local, global...)
+		kind, reads := classifyStripeWrite(w, partial, k, len(parities))
+		delta.updates[kind]++
+		delta.dataWrites += int64(w)
+		delta.extraReads += int64(reads)
+		delta.parityWrite += int64(len(parities))
+		delta.localParity += int64(len(local))
+
+		switch kind {
+		case writeReconstruct:
+			for pos := 0; pos < k; pos++ {
+				if pos < first || pos > last {
+					st.device(stripe, pos, true)
+				}
+			}
+			if firstPartial {
+				st.device(stripe, first, true)
+			}
+			if lastPartial && (w > 1 || !firstPartial) {
+				st.device(stripe, last, true)
+			}
+		case writeRMW:
+			for pos := first; pos <= last; pos++ {
+				st.device(stripe, pos, true)
+			}
+			for _, pos := range parities {
+				st.device(stripe, pos, true)
+			}
+		}
+		for pos := first; pos <= last; pos++ {
+			st.access(stripe, pos, false, ts)
+			st.device(stripe, pos, false)
+		}
+		for _, pos := range parities {
+			st.device(stripe, pos, false)
+		}
+	}
+	if !isRead {
+		mc, ok := st.costMinute[minuteKey]
+		if !ok {
+			mc = &stripeCost{}
+			st.costMinute[minuteKey] = mc
+		}
+		mc.add(&delta)
+	}
+	st.mu.Unlock()
+	if st.spill != nil {
+		st.spill.budget.enforce()
+	}
+}
+
+func writeStripeStats(path string, st *stripeState) error {
+	st.mu.Lock()
+	keys := make([]int, 0, len(st.updateMap))
+	for k := range st.updateMap {
+		keys = append(keys, k)
+	}
+	// Copy map data
+	statsCopy := make(map[int]int, len(st.updateMap))
+	for k, v := range st.updateMap {
+		statsCopy[k] = v
+	}
+	st.mu.Unlock()
+
+	sort.Ints(keys)
+
+	header := []string{"UpdatedBlocksInStripe", "Count"}
+	rows := make([][]string, len(keys))
+	for i, k := range keys {
+		rows[i] = []string{strconv.Itoa(k), strconv.Itoa(statsCopy[k])}
+	}
+	return writeCSV(path, header, rows)
+}
+
+// writeStripeHeatMap 输出条带 × 块位置的访问次数：device 为 false 时是逻辑 IO 的访问（stripe_block_heatmap.csv），
+// 为 true 时是设备访问（stripe_disk_heatmap.csv），后者包含校验与重构流量，按 Disk 列即可看出物理磁盘热点
+func writeStripeHeatMap(path string, st *stripeState, device bool) error {
+	st.mu.Lock()
+	heat := st.heatMap
+	if device {
+		heat = st.deviceHeat
+	}
+	stripeIDs := make([]int64, 0, len(heat))
+
+	// Deep copy needed
+	dataCopy := make(map[int64][]CountPair, len(heat))
+	for k, v := range heat {
+		stripeIDs = append(stripeIDs, k)
+		// Deep copy the slice
+		newSlice := make([]CountPair, len(v))
+		copy(newSlice, v)
+		dataCopy[k] = newSlice
+	}
+	st.mu.Unlock()
+
+	sort.Slice(stripeIDs, func(i, j int) bool { return stripeIDs[i] < stripeIDs[j] })
+
+	var rows [][]string
+	for _, sid := range stripeIDs {
+		counters := dataCopy[sid]
+		for idx := 0; idx < len(counters); idx++ {
+			reads := counters[idx].Reads
+			writes := counters[idx].Writes
+			if reads == 0 && writes == 0 {
+				continue
+			}
+			blockType := st.cfg.blockType(idx)
+			rows = append(rows, []string{
+				strconv.FormatInt(sid, 10),
+				strconv.Itoa(idx),
+				blockType,
+				strconv.Itoa(st.cfg.disk(sid, idx)),
+				strconv.FormatInt(reads, 10),
+				strconv.FormatInt(writes, 10),
+				strconv.FormatInt(reads+writes, 10),
+			})
+		}
+	}
+
+	header := []string{"StripeID", "BlockIndex", "BlockType", "Disk", "Reads", "Writes", "TotalOps"}
+	return writeCSV(path, header, rows)
+}
+
+// writeStripeDiskLoad 输出每块模拟磁盘上的数据/校验设备访问次数（含写代价模型的额外读与校验写）
+func writeStripeDiskLoad(path string, st *stripeState) error {
+	st.mu.Lock()
+	data := append([]CountPair(nil), st.diskData...)
+	parity := append([]CountPair(nil), st.diskParity...)
+	st.mu.Unlock()
+
+	header := []string{"Disk", "DataReads", "DataWrites", "ParityReads", "ParityWrites", "TotalOps"}
+	rows := make([][]string, len(data))
+	for d := range data {
+		total := data[d].Reads + data[d].Writes + parity[d].Reads + parity[d].Writes
+		rows[d] = []string{
+			strconv.Itoa(d),
+			strconv.FormatInt(data[d].Reads, 10),
+			strconv.FormatInt(data[d].Writes, 10),
+			strconv.FormatInt(parity[d].Reads, 10),
+			strconv.FormatInt(parity[d].Writes, 10),
+			strconv.FormatInt(total, 10),
+		}
+	}
+	return writeCSV(path, header, rows)
+}
+
+// writeStripeOutputs 输出所有目标卷 × 条带配置的结果以及跨卷汇总 stripe_volume_summary.csv。
+// 只有一个目标卷时直接写在 outDir 下，多个卷时写入 outDir/stripe_volumes/<卷>/；
+// 只有一个配置时不再分子目录（与单配置运行一致），多配置时再分 <EC>/<Size>/。
+func writeStripeOutputs(outDir string, ag *Aggregator) error {
+	vols := ag.targetVolumes()
+	for _, vol := range vols {
+		volDir := outDir
+		if len(vols) > 1 {
+			volDir = filepath.Join(outDir, "stripe_volumes", safeFileName(vol))
+		}
+		for _, st := range ag.stripesFor(vol) {
+			dir := volDir
+			if len(ag.stripeCfgs) > 1 {
+				dir = filepath.Join(volDir, st.cfg.Dir())
+			}
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+			if err := writeStripeConfigOutputs(dir, st, ag.coalesceWindows); err != nil {
+				return fmt.Errorf("%s %s: %w", vol, st.cfg.Dir(), err)
+			}
+		}
+	}
+	return writeStripeVolumeSummary(filepath.Join(outDir, "stripe_volume_summary.csv"), ag, vols)
+}
+
+func writeStripeConfigOutputs(dir string, st *stripeState, windows []time.Duration) error {
+	if err := st.spillErr(); err != nil {
+		// 落盘失败后明细已不完整：跳过 stripe_ops.csv 及由它推出的更新间隔/写合并统计，其余结果照常输出
+		st.spill.close()
+		fmt.Printf("跳过 %s 的 stripe_ops.csv、stripe_update_interval*.csv 与 stripe_coalesce.csv: %v\n", dir, err)
+	} else {
+		tl := newStripeTimeline(&st.cfg, windows)
+		if err := writeStripeOpsCSV(filepath.Join(dir, "stripe_ops.csv"), st, tl.observe); err != nil {
+			return fmt.Errorf("stripe ops: %w", err)
+		}
+		if err := writeStripeTimelineCSVs(dir, tl); err != nil {
+			return fmt.Errorf("stripe timeline: %w", err)
+		}
+	}
+	if err := writeStripeStats(filepath.Join(dir, "stripe_stats.csv"), st); err != nil {
+		return fmt.Errorf("stripe stats: %w", err)
+	}
+	if err := writeStripeHeatMap(filepath.Join(dir, "stripe_block_heatmap.csv"), st, false); err != nil {
+		return fmt.Errorf("stripe heatmap: %w", err)
+	}
+	if err := writeStripeHeatMap(filepath.Join(dir, "stripe_disk_heatmap.csv"), st, true); err != nil {
+		return fmt.Errorf("stripe disk heatmap: %w", err)
+	}
+	if err := writeStripeCostCSV(filepath.Join(dir, "stripe_write_cost.csv"), st); err != nil {
+		return fmt.Errorf("stripe write cost: %w", err)
+	}
+	if err := writeStripeDiskLoad(filepath.Join(dir, "stripe_disk_load.csv"), st); err != nil {
+		return fmt.Errorf("stripe disk load: %w", err)
+	}
+	if err := writeStripeNodeCSVs(dir, st); err != nil {
+		return fmt.Errorf("stripe node load: %w", err)
+	}
+	if err := writeStripeDegradedCSV(dir, st); err != nil {
+		return fmt.Errorf("stripe degraded: %w", err)
+	}
+	return nil
+}
+
+// writeStripeVolumeSummary 输出跨卷汇总：每个卷 × 配置一行，便于横向比较写代价
+func writeStripeVolumeSummary(path string, ag *Aggregator, vols []string) error {
+	header := []string{"VolumeID", "EC", "BlockSize", "Layout", "TouchedStripes", "BlockReads", "BlockWrites",
+		"StripeUpdates", "FullStripe", "ReconstructWrite", "ReadModifyWrite",
+		"DataBlockWrites", "ExtraBlockReads", "ParityBlockWrites", "WriteAmplification", "IOAmplification",
+		"LocalParityBlockWrites", "GlobalParityBlockWrites"}
+	var rows [][]string
+	for _, vol := range vols {
+		for _, st := range ag.stripesFor(vol) {
+			var total stripeCost
+			var blocks CountPair
+			st.mu.Lock()
+			for _, c := range st.costMinute {
+				total.add(c)
+			}
+			for _, counters := range st.heatMap {
+				for i := range counters {
+					blocks.merge(&counters[i])
+				}
+			}
+			touched := len(st.heatMap)
+			st.mu.Unlock()
+
+			layout := st.cfg.Layout
+			if layout == "" {
+				layout = LayoutDedicated
+			}
+			row := []string{vol, st.cfg.ECLabel(), st.cfg.SizeLabel(), layout,
+				strconv.Itoa(touched),
+				strconv.FormatInt(blocks.Reads, 10),
+				strconv.FormatInt(blocks.Writes, 10),
+			}
+			rows = append(rows, append(row, stripeCostRow("", &total)[1:]...))
+		}
+	}
+	return writeCSV(path, header, rows)
+}
+
+// safeFileName 将卷 ID 中不能出现在路径里的字符替换为 '_'
+func safeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		return r
+	}, s)
+}
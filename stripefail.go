@@ -0,0 +1,277 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// FailureSpec 描述一次模拟故障：Units 在 At 时刻失效（启用节点放置时为节点编号，否则为磁盘编号），
+// 之后后台以 RepairRate bytes/s 的速度按条带号顺序重建丢失的块；RepairRate 为 0 表示不修复。
+type FailureSpec struct {
+	Units      []int
+	At         time.Time
+	RepairRate int64
+}
+
+// degradedCounters 是降级读与修复流量的计数（单位：block）
+type degradedCounters struct {
+	reads         int64 // 数据块读
+	degraded      int64 // 落在丢失且未修复块上的读
+	unrecoverable int64 // 丢失块数超过校验块数、无法解码的读
+	extraReads    int64 // 降级读相对正常读多读取的块数
+	repairReads   int64
+	repairWrites  int64
+}
+
+func (c *degradedCounters) add(o *degradedCounters) {
+	c.reads += o.reads
+	c.degraded += o.degraded
+	c.unrecoverable += o.unrecoverable
+	c.extraReads += o.extraReads
+	c.repairReads += o.repairReads
+	c.repairWrites += o.repairWrites
+}
+
+// failureState 保存某个条带配置下的故障与修复进度（由 stripeState.mu 保护）
+type failureState struct {
+	spec   FailureSpec
+	failed map[int]bool
+
+	cursor    int64 // 编号小于 cursor 的条带已修复
+	maxStripe int64 // trace 中出现过的最大条带号，视为卷的范围
+	last      time.Time
+	budget    float64 // 尚未用完的修复字节额度
+
+	minute map[string]*degradedCounters
+}
+
+func newFailureState(spec FailureSpec) *failureState {
+	fs := &failureState{
+		spec:      spec,
+		failed:    make(map[int]bool, len(spec.Units)),
+		maxStripe: -1,
+		minute:    make(map[string]*degradedCounters),
+	}
+	for _, u := range spec.Units {
+		fs.failed[u] = true
+	}
+	return fs
+}
+
+func (fs *failureState) active(ts time.Time) bool { return !ts.Before(fs.spec.At) }
+
+func (fs *failureState) counters(minuteKey string) *degradedCounters {
+	c, ok := fs.minute[minuteKey]
+	if !ok {
+		c = &degradedCounters{}
+		fs.minute[minuteKey] = c
+	}
+	return c
+}
+
+// lost 判断条带 stripe 的位置 pos 是否位于失效单元上
+func (st *stripeState) lost(stripe int64, pos int) bool {
+	disk := st.cfg.disk(stripe, pos)
+	if st.placer != nil {
+		return st.fail.failed[st.placer.node(stripe, disk)]
+	}
+	return st.fail.failed[disk]
+}
+
+func (st *stripeState) lostInStripe(stripe int64) int {
+	n := 0
+	for pos := 0; pos < st.cfg.width(); pos++ {
+		if st.lost(stripe, pos) {
+			n++
+		}
+	}
+	return n
+}
+
+// advanceRepair 按修复速率推进修复游标到 now，修复流量计入 minuteKey
+func (st *stripeState) advanceRepair(now time.Time, minuteKey string) {
+	fs := st.fail
+	if fs.spec.RepairRate <= 0 || !fs.active(now) {
+		return
+	}
+	if fs.last.IsZero() {
+		// 未指定 -fail_at 时故障从 trace 开头生效，修复时钟从第一条记录开始计
+		fs.last = fs.spec.At
+		if fs.last.IsZero() {
+			fs.last = now
+		}
+	}
+	if !now.After(fs.last) {
+		return
+	}
+	fs.budget += float64(fs.spec.RepairRate) * now.Sub(fs.last).Seconds()
+	fs.last = now
+	c := fs.counters(minuteKey)
+	for fs.cursor <= fs.maxStripe {
+		n := st.lostInStripe(fs.cursor)
+		cost := float64(int64(n) * st.cfg.BlockSize)
+		if cost > fs.budget {
+			return
+		}
+		fs.budget -= cost
+		if n > 0 {
+			c.repairReads += int64(st.repairReads(fs.cursor))
+			c.repairWrites += int64(n)
+		}
+		fs.cursor++
+	}
+	// 已追上卷的范围，空闲期间不积累额度
+	fs.budget = 0
+}
+
+// decodeSources 返回恢复条带 stripe 中丢失位置 pos 需要读取的存活位置，无法恢复时返回 nil。
+// LRC 下若所在本地组只丢了这一块，只读组内其余块；否则读取 k 个存活块做全局解码。
+func (st *stripeState) decodeSources(stripe int64, pos int) []int {
+	if st.lostInStripe(stripe) > st.cfg.tolerance() {
+		return nil
+	}
+	if g := st.cfg.localGroup(pos); g >= 0 {
+		members := st.cfg.groupMembers(g)
+		sources := make([]int, 0, len(members)-1)
+		for _, p := range members {
+			if p == pos {
+				continue
+			}
+			if st.lost(stripe, p) {
+				sources = nil
+				break
+			}
+			sources = append(sources, p)
+		}
+		if sources != nil {
+			return sources
+		}
+	}
+	k := st.cfg.DataBlocks
+	sources := make([]int, 0, k)
+	for p := 0; p < st.cfg.width() && len(sources) < k; p++ {
+		if !st.lost(stripe, p) {
+			sources = append(sources, p)
+		}
+	}
+	return sources
+}
+
+// repairReads 返回重建条带 stripe 全部丢失块需要读取的块数，多个块共用一次全局解码
+func (st *stripeState) repairReads(stripe int64) int {
+	reads, global := 0, false
+	for pos := 0; pos < st.cfg.width(); pos++ {
+		if !st.lost(stripe, pos) {
+			continue
+		}
+		sources := st.decodeSources(stripe, pos)
+		switch {
+		case sources == nil:
+		case st.cfg.localGroup(pos) >= 0 && len(sources) < st.cfg.DataBlocks:
+			reads += len(sources)
+		case !global:
+			reads += len(sources)
+			global = true
+		}
+	}
+	return reads
+}
+
+// readBlock 处理一次数据块读：逻辑读计入热力图；设备上未失效或已修复时直接读取，否则按 decodeSources 降级读
+func (st *stripeState) readBlock(stripe int64, pos int, ts time.Time, minuteKey string) {
+	st.access(stripe, pos, true, ts)
+	fs := st.fail
+	if fs == nil || !fs.active(ts) {
+		st.device(stripe, pos, true)
+		return
+	}
+	c := fs.counters(minuteKey)
+	c.reads++
+	if stripe < fs.cursor || !st.lost(stripe, pos) {
+		st.device(stripe, pos, true)
+		return
+	}
+	c.degraded++
+	sources := st.decodeSources(stripe, pos)
+	if sources == nil {
+		c.unrecoverable++
+		return
+	}
+	for _, p := range sources {
+		st.device(stripe, p, true)
+	}
+	c.extraReads += int64(len(sources) - 1)
+}
+
+func degradedRow(key string, c *degradedCounters, blockSize int64) []string {
+	return []string{
+		key,
+		strconv.FormatInt(c.reads, 10),
+		strconv.FormatInt(c.degraded, 10),
+		strconv.FormatInt(c.unrecoverable, 10),
+		strconv.FormatInt(c.extraReads, 10),
+		formatAmplification(c.reads+c.extraReads, c.reads),
+		strconv.FormatInt(c.repairReads, 10),
+		strconv.FormatInt(c.repairWrites, 10),
+		strconv.FormatInt((c.repairReads+c.repairWrites)*blockSize, 10),
+	}
+}
+
+// writeStripeDegradedCSV 输出 stripe_degraded.csv：故障后每分钟的降级读放大与修复流量，ALL 为汇总
+func writeStripeDegradedCSV(dir string, st *stripeState) error {
+	if st.fail == nil {
+		return nil
+	}
+	st.mu.Lock()
+	keys := make([]string, 0, len(st.fail.minute))
+	snapshot := make(map[string]degradedCounters, len(st.fail.minute))
+	for k, v := range st.fail.minute {
+		keys = append(keys, k)
+		snapshot[k] = *v
+	}
+	cursor, maxStripe := st.fail.cursor, st.fail.maxStripe
+	st.mu.Unlock()
+	sort.Strings(keys)
+
+	header := []string{"Minute", "BlockReads", "DegradedReads", "UnrecoverableReads", "ExtraBlockReads",
+		"ReadAmplification", "RepairBlockReads", "RepairBlockWrites", "RepairBytes"}
+	rows := make([][]string, 0, len(keys)+1)
+	var total degradedCounters
+	for _, k := range keys {
+		c := snapshot[k]
+		total.add(&c)
+		rows = append(rows, degradedRow(k, &c, st.cfg.BlockSize))
+	}
+	rows = append(rows, degradedRow("ALL", &total, st.cfg.BlockSize))
+	if err := writeCSV(filepath.Join(dir, "stripe_degraded.csv"), header, rows); err != nil {
+		return err
+	}
+	repaired := "0.00"
+	if maxStripe >= 0 {
+		repaired = calculateReadRatioPercent(min(cursor, maxStripe+1), maxStripe+1)
+	}
+	return writeCSV(filepath.Join(dir, "stripe_repair_summary.csv"),
+		[]string{"FailedUnits", "FailAt", "RepairRate(B/s)", "StripesSeen", "StripesRepaired", "Repaired(%)", "RepairBytes"},
+		[][]string{{
+			formatUnits(st.fail.spec.Units),
+			st.fail.spec.At.Format("2006-01-02 15:04:05"),
+			strconv.FormatInt(st.fail.spec.RepairRate, 10),
+			strconv.FormatInt(maxStripe+1, 10),
+			strconv.FormatInt(min(cursor, maxStripe+1), 10),
+			repaired,
+			strconv.FormatInt((total.repairReads+total.repairWrites)*st.cfg.BlockSize, 10),
+		}})
+}
+
+func formatUnits(units []int) string {
+	s := ""
+	for i, u := range units {
+		if i > 0 {
+			s += ";"
+		}
+		s += strconv.Itoa(u)
+	}
+	return s
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 条带布局：决定条带内各位置（数据 0..k-1，校验 k..width-1）落在哪块模拟磁盘上
+const (
+	LayoutDedicated   = "dedicated"   // 固定校验盘：位置 i 始终位于磁盘 i
+	LayoutRotated     = "rotated"     // RAID-5/6 left-symmetric：校验随条带号轮转
+	LayoutDeclustered = "declustered" // 每个条带的 k+m 个单元伪随机分布在 Disks 块盘上
+)
+
+func parseStripeLayout(s string) (string, error) {
+	switch l := strings.ToLower(strings.TrimSpace(s)); l {
+	case "", LayoutDedicated:
+		return LayoutDedicated, nil
+	case LayoutRotated, "left-symmetric", "raid5", "raid6":
+		return LayoutRotated, nil
+	case LayoutDeclustered:
+		return LayoutDeclustered, nil
+	default:
+		return "", fmt.Errorf("unknown stripe layout %q (dedicated|rotated|declustered)", s)
+	}
+}
+
+// width 返回条带宽度 k+m（LRC 为 k+l+r）
+func (c StripeConfig) width() int { return c.DataBlocks + c.LocalParities + c.ParityBlocks }
+
+// DiskCount 返回模拟磁盘数
+func (c StripeConfig) DiskCount() int {
+	if c.Layout == LayoutDeclustered && c.Disks > c.width() {
+		return c.Disks
+	}
+	return c.width()
+}
+
+// locate 将逻辑数据块映射为 (条带号, 数据位置)；校验位置不占用数据地址空间
+func (c StripeConfig) locate(block int64) (int64, int) {
+	k := int64(c.DataBlocks)
+	return block / k, int(block % k)
+}
+
+// disk 返回条带 stripe 中位置 pos 所在的磁盘编号
+func (c StripeConfig) disk(stripe int64, pos int) int {
+	n := c.width()
+	switch c.Layout {
+	case LayoutRotated:
+		// left-symmetric：数据与校验整体随条带号左移，
+		// 单校验时校验盘为 n-1-(s mod n)，数据从其后一块盘开始
+		rot := int(stripe % int64(n))
+		return (pos - rot + n) % n
+	case LayoutDeclustered:
+		d := c.DiskCount()
+		if d == n {
+			return pos
+		}
+		return declusteredDisk(stripe, pos, d)
+	default:
+		return pos
+	}
+}
+
+// declusteredDisk 对 [0, disks) 做以条带号为种子的部分 Fisher-Yates 洗牌，取第 pos 个
+func declusteredDisk(stripe int64, pos, disks int) int {
+	// 小规模直接在栈上洗牌
+	var buf [256]int
+	var perm []int
+	if disks <= len(buf) {
+		perm = buf[:disks]
+	} else {
+		perm = make([]int, disks)
+	}
+	for i := range perm {
+		perm[i] = i
+	}
+	seed := mix64(uint64(stripe) + 0x9e3779b97f4a7c15)
+	for i := 0; i <= pos; i++ {
+		seed = mix64(seed)
+		j := i + int(seed%uint64(disks-i))
+		perm[i], perm[j] = perm[j], perm[i]
+	}
+	return perm[pos]
+}
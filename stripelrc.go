@@ -0,0 +1,76 @@
+package main
+
+// LRC(k, l, r)：k 个数据块分成 l 个本地组，每组一个本地校验，另有 r 个全局校验。
+// 条带内位置依次为 数据 0..k-1、本地校验 k..k+l-1、全局校验 k+l..k+l+r-1；
+// LocalParities 为 0 时退化为 k+r 的 RS 条带。
+
+// isLRC 判断是否为带本地组的配置
+func (c StripeConfig) isLRC() bool { return c.LocalParities > 0 }
+
+// groupStart 返回本地组 g 的第一个数据位置。k 个数据块均分到 l 个组：
+// 前 k%l 个组各 k/l+1 块，其余各 k/l 块，每个组至少有一个数据块
+func (c StripeConfig) groupStart(g int) int {
+	q, r := c.DataBlocks/c.LocalParities, c.DataBlocks%c.LocalParities
+	return g*q + min(g, r)
+}
+
+// localGroup 返回数据位置或本地校验位置所属的本地组，全局校验返回 -1
+func (c StripeConfig) localGroup(pos int) int {
+	switch {
+	case !c.isLRC() || pos >= c.DataBlocks+c.LocalParities:
+		return -1
+	case pos >= c.DataBlocks:
+		return pos - c.DataBlocks
+	}
+	q, r := c.DataBlocks/c.LocalParities, c.DataBlocks%c.LocalParities
+	if big := r * (q + 1); pos >= big {
+		return r + (pos-big)/q
+	}
+	return pos / (q + 1)
+}
+
+// groupMembers 返回本地组 g 的数据位置与本地校验位置
+func (c StripeConfig) groupMembers(g int) []int {
+	start, end := c.groupStart(g), c.groupStart(g+1)
+	members := make([]int, 0, end-start+1)
+	for pos := start; pos < end; pos++ {
+		members = append(members, pos)
+	}
+	return append(members, c.DataBlocks+g)
+}
+
+// blockType 返回位置 pos 的块类型；RS 的校验块仍记为 "Parity"，保持与旧输出一致
+func (c StripeConfig) blockType(pos int) string {
+	switch {
+	case pos < c.DataBlocks:
+		return "Data"
+	case !c.isLRC():
+		return "Parity"
+	case pos < c.DataBlocks+c.LocalParities:
+		return "LocalParity"
+	default:
+		return "GlobalParity"
+	}
+}
+
+// tolerance 返回保证可恢复的最大丢失块数：RS 为 m，LRC 为 r+1
+func (c StripeConfig) tolerance() int {
+	if c.isLRC() {
+		return c.ParityBlocks + 1
+	}
+	return c.ParityBlocks
+}
+
+// updatedParities 返回写入数据位置 [first, last] 时需要更新的校验位置：
+// 被写到的本地组的本地校验，以及全部全局校验。
+func (c StripeConfig) updatedParities(first, last int) (local, global []int) {
+	if c.isLRC() {
+		for g := c.localGroup(first); g <= c.localGroup(last); g++ {
+			local = append(local, c.DataBlocks+g)
+		}
+	}
+	for pos := c.DataBlocks + c.LocalParities; pos < c.width(); pos++ {
+		global = append(global, pos)
+	}
+	return local, global
+}
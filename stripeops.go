@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// stripeOpRecordSize 是 run 文件中单条操作的编码长度：
+// StripeID(8) + UnixNano(8) + BlockIndex(4) + Disk(4) + IsRead(1) + IO(8)
+const stripeOpRecordSize = 33
+
+// stripeOpMemSize 是内存中单条 StripeOperation 的近似大小，用于把内存预算换算成条数
+const stripeOpMemSize = int64(unsafe.Sizeof(StripeOperation{}))
+
+// opsBudget 是所有卷 × 条带配置共享的 stripe_ops 内存预算：各状态缓冲容量之和超过 limit 时，
+// 把当前最大的缓冲排序落盘并释放，直到重新回到预算之内
+type opsBudget struct {
+	limit int64        // 所有状态合计最多缓存的操作条数
+	base  string       // 临时目录的父目录
+	used  atomic.Int64 // 所有状态 ops 缓冲的容量之和
+
+	mu     sync.Mutex // 串行化 enforce 与 register
+	states []*stripeState
+}
+
+// opsSpill 把单个状态的 stripe 操作分批排序后写入临时 run 文件，
+// 结束时与内存中剩余的一批做 k 路归并，按时间顺序写出 stripe_ops.csv
+type opsSpill struct {
+	budget *opsBudget
+	name   string // 卷与配置，用于报错
+	dir    string // 首次落盘时创建
+	runs   []string
+	loc    *time.Location // 时间戳的时区，回读时恢复
+	err    error          // 第一次落盘失败的错误，写出时返回
+}
+
+func (s *opsSpill) close() {
+	if s.dir != "" {
+		os.RemoveAll(s.dir)
+	}
+}
+
+// SetStripeOpsBudget 设置 stripe_ops 的内存预算（字节，所有卷 × 条带配置共享），超出后落盘到 spillDir 下的临时目录
+func (ag *Aggregator) SetStripeOpsBudget(memBytes int64, spillDir string) {
+	ag.stripesMu.Lock()
+	defer ag.stripesMu.Unlock()
+	if memBytes <= 0 {
+		ag.opsBudget = nil
+		return
+	}
+	ag.opsBudget = &opsBudget{limit: max(memBytes/stripeOpMemSize, 1), base: spillDir}
+	for vol, states := range ag.volStripes {
+		ag.opsBudget.register(vol, states)
+	}
+}
+
+// register 让新建的条带状态参与预算（在状态开始接收记录之前调用）
+func (b *opsBudget) register(vol string, states []*stripeState) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, st := range states {
+		st.mu.Lock()
+		st.spill = &opsSpill{budget: b, name: vol + " " + st.cfg.Dir()}
+		b.used.Add(int64(cap(st.ops)))
+		st.mu.Unlock()
+		b.states = append(b.states, st)
+	}
+}
+
+// enforce 在超出预算时反复落盘当前最大的缓冲（调用方不能持有任何 st.mu）
+func (b *opsBudget) enforce() {
+	if b.used.Load() <= b.limit {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.used.Load() > b.limit {
+		var big *stripeState
+		n := 0
+		for _, st := range b.states {
+			st.mu.Lock()
+			if len(st.ops) > n {
+				big, n = st, len(st.ops)
+			}
+			st.mu.Unlock()
+		}
+		if big == nil {
+			return
+		}
+		big.mu.Lock()
+		big.spillOps()
+		big.mu.Unlock()
+	}
+}
+
+// appendOp 记录一次条带操作，并把缓冲扩容计入共享预算（调用方持有 st.mu）
+func (st *stripeState) appendOp(op StripeOperation) {
+	c := cap(st.ops)
+	st.ops = append(st.ops, op)
+	if st.spill != nil && cap(st.ops) != c {
+		st.spill.budget.used.Add(int64(cap(st.ops) - c))
+	}
+}
+
+// sortStripeOps 按时间稳定排序，同一时间戳的操作保持追加顺序
+func sortStripeOps(ops []StripeOperation) {
+	sort.SliceStable(ops, func(i, j int) bool {
+		return ops[i].OptionTime.Before(ops[j].OptionTime)
+	})
+}
+
+// spillOps 把当前缓冲写成一个 run 文件并释放缓冲；首次失败时立即报告，之后的操作直接丢弃（调用方持有 st.mu）
+func (st *stripeState) spillOps() {
+	sp := st.spill
+	if sp.err == nil {
+		if err := st.writeRun(); err != nil {
+			sp.err = err
+			fmt.Printf("警告: stripe_ops 落盘失败 (%s)，之后的明细将被丢弃，stripe_ops.csv 与更新间隔/写合并统计不会输出: %v\n", sp.name, err)
+		}
+	}
+	sp.budget.used.Add(-int64(cap(st.ops)))
+	st.ops = nil
+}
+
+// spillErr 返回第一次落盘失败的错误，未落盘或未失败时为 nil
+func (st *stripeState) spillErr() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.spill == nil {
+		return nil
+	}
+	return st.spill.err
+}
+
+// writeRun 将当前缓存排序后写成一个 run 文件
+func (st *stripeState) writeRun() error {
+	sortStripeOps(st.ops)
+	if st.spill.dir == "" {
+		dir, err := os.MkdirTemp(st.spill.budget.base, "stripe_ops_*")
+		if err != nil {
+			return err
+		}
+		st.spill.dir = dir
+	}
+	if st.spill.loc == nil {
+		st.spill.loc = st.ops[0].OptionTime.Location()
+	}
+	path := filepath.Join(st.spill.dir, fmt.Sprintf("run_%05d.bin", len(st.spill.runs)))
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriterSize(f, 1<<20)
+	var buf [stripeOpRecordSize]byte
+	for i := range st.ops {
+		encodeStripeOp(buf[:], &st.ops[i])
+		if _, err := w.Write(buf[:]); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	st.spill.runs = append(st.spill.runs, path)
+	return nil
+}
+
+func encodeStripeOp(buf []byte, op *StripeOperation) {
+	binary.LittleEndian.PutUint64(buf[0:], uint64(op.StripeID))
+	binary.LittleEndian.PutUint64(buf[8:], uint64(op.OptionTime.UnixNano()))
+	binary.LittleEndian.PutUint32(buf[16:], uint32(op.BlockIndex))
+	binary.LittleEndian.PutUint32(buf[20:], uint32(op.Disk))
+	buf[24] = 0
+	if op.ReadWrite == "Read" {
+		buf[24] = 1
+	}
+	binary.LittleEndian.PutUint64(buf[25:], op.IO)
+}
+
+func decodeStripeOp(buf []byte, cfg *StripeConfig, loc *time.Location) StripeOperation {
+	op := StripeOperation{
+		StripeID:   int64(binary.LittleEndian.Uint64(buf[0:])),
+		OptionTime: time.Unix(0, int64(binary.LittleEndian.Uint64(buf[8:]))).In(loc),
+		BlockIndex: int(binary.LittleEndian.Uint32(buf[16:])),
+		Disk:       int(binary.LittleEndian.Uint32(buf[20:])),
+		ReadWrite:  "Write",
+		IO:         binary.LittleEndian.Uint64(buf[25:]),
+	}
+	op.BlockType = cfg.blockType(op.BlockIndex)
+	if buf[24] == 1 {
+		op.ReadWrite = "Read"
+	}
+	return op
+}
+
+// opsSource 是归并的一路输入：一个 run 文件或内存中剩余的已排序切片
+type opsSource struct {
+	idx int // 先落盘的 run 在前，内存剩余部分最后；同一时间戳按 idx 保持追加顺序
+	r   *bufio.Reader
+	f   *os.File
+	mem []StripeOperation
+	cur StripeOperation
+	buf [stripeOpRecordSize]byte
+}
+
+func (s *opsSource) next(cfg *StripeConfig, loc *time.Location) (bool, error) {
+	if s.r == nil {
+		if len(s.mem) == 0 {
+			return false, nil
+		}
+		s.cur, s.mem = s.mem[0], s.mem[1:]
+		return true, nil
+	}
+	if _, err := io.ReadFull(s.r, s.buf[:]); err != nil {
+		if err == io.EOF {
+			return false, nil
+		}
+		return false, err
+	}
+	s.cur = decodeStripeOp(s.buf[:], cfg, loc)
+	return true, nil
+}
+
+type opsHeap []*opsSource
+
+func (h opsHeap) Len() int { return len(h) }
+func (h opsHeap) Less(i, j int) bool {
+	if !h[i].cur.OptionTime.Equal(h[j].cur.OptionTime) {
+		return h[i].cur.OptionTime.Before(h[j].cur.OptionTime)
+	}
+	return h[i].idx < h[j].idx
+}
+func (h opsHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *opsHeap) Push(x any)   { *h = append(*h, x.(*opsSource)) }
+func (h *opsHeap) Pop() any {
+	old := *h
+	s := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return s
+}
+
+func stripeOpRow(op *StripeOperation) []string {
+	return []string{
+		strconv.FormatInt(op.StripeID, 10),
+		strconv.Itoa(op.BlockIndex),
+		op.BlockType,
+		op.ReadWrite,
+		strconv.Itoa(op.Disk),
+		op.OptionTime.Format("2006-01-02 15:04:05.000000"),
+	}
+}
+
+// writeStripeOpsCSV 输出指定卷的详细条带操作日志（按时间排序），observe 非 nil 时按同样顺序逐条回调。
+// 未落盘时直接排序写出；否则对所有 run 文件与内存剩余部分做 k 路归并，内存占用与 run 数成正比。
+func writeStripeOpsCSV(path string, st *stripeState, observe func(*StripeOperation)) error {
+	st.mu.Lock()
+	ops := make([]StripeOperation, len(st.ops))
+	copy(ops, st.ops)
+	var runs []string
+	var loc *time.Location
+	if st.spill != nil {
+		if st.spill.err != nil {
+			st.mu.Unlock()
+			return fmt.Errorf("spill stripe ops: %w", st.spill.err)
+		}
+		runs = append(runs, st.spill.runs...)
+		loc = st.spill.loc
+	}
+	st.mu.Unlock()
+	if st.spill != nil {
+		defer st.spill.close()
+	}
+	sortStripeOps(ops)
+
+	header := []string{"StripeID", "BlockIndex", "BlockType", "Read/Write", "Disk", "OptionTime"}
+	if len(runs) == 0 {
+		rows := make([][]string, len(ops))
+		for i := range ops {
+			rows[i] = stripeOpRow(&ops[i])
+			if observe != nil {
+				observe(&ops[i])
+			}
+		}
+		return writeCSV(path, header, rows)
+	}
+
+	h := make(opsHeap, 0, len(runs)+1)
+	for _, run := range runs {
+		f, err := os.Open(run)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		h = append(h, &opsSource{idx: len(h), f: f, r: bufio.NewReaderSize(f, 256<<10)})
+	}
+	h = append(h, &opsSource{idx: len(h), mem: ops})
+	live := h[:0]
+	for _, s := range h {
+		ok, err := s.next(&st.cfg, loc)
+		if err != nil {
+			return err
+		}
+		if ok {
+			live = append(live, s)
+		}
+	}
+	h = live
+	heap.Init(&h)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	for h.Len() > 0 {
+		s := h[0]
+		if err := w.Write(stripeOpRow(&s.cur)); err != nil {
+			return err
+		}
+		if observe != nil {
+			observe(&s.cur)
+		}
+		ok, err := s.next(&st.cfg, loc)
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	fmt.Printf("已写出: %s\n", path)
+	return nil
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 条带到存储节点的放置策略
+const (
+	PlacementRoundRobin = "rr"     // 条带依次轮转放置
+	PlacementRandom     = "random" // 以 seed 为种子为每个条带随机选择不同节点
+	PlacementCHash      = "chash"  // 一致性哈希环（带虚拟节点），顺时针取不同节点
+)
+
+func parsePlacement(s string) (string, error) {
+	switch p := strings.ToLower(strings.TrimSpace(s)); p {
+	case "", PlacementRoundRobin, "round-robin":
+		return PlacementRoundRobin, nil
+	case PlacementRandom:
+		return PlacementRandom, nil
+	case PlacementCHash, "consistent-hash":
+		return PlacementCHash, nil
+	default:
+		return "", fmt.Errorf("unknown placement %q (rr|random|chash)", s)
+	}
+}
+
+// Placement 描述模拟集群与放置方式，Nodes 为 0 表示不做节点放置分析
+type Placement struct {
+	Nodes  int
+	Policy string
+	Seed   int64
+	VNodes int // 一致性哈希每个节点的虚拟节点数
+}
+
+// placer 将 (条带号, 磁盘编号) 映射到存储节点，同一条带的不同磁盘落在不同节点
+type placer struct {
+	p     Placement
+	disks int
+
+	ring      []uint64 // 已排序的虚拟节点哈希
+	ringNodes []int    // 对应的物理节点
+}
+
+func newPlacer(p Placement, disks int) *placer {
+	pl := &placer{p: p, disks: disks}
+	if p.Policy == PlacementCHash {
+		vn := p.VNodes
+		if vn <= 0 {
+			vn = 100
+		}
+		type point struct {
+			h    uint64
+			node int
+		}
+		points := make([]point, 0, p.Nodes*vn)
+		for n := 0; n < p.Nodes; n++ {
+			for v := 0; v < vn; v++ {
+				h := fnv.New64a()
+				fmt.Fprintf(h, "node-%d#%d", n, v)
+				points = append(points, point{mix64(h.Sum64()), n})
+			}
+		}
+		sort.Slice(points, func(i, j int) bool { return points[i].h < points[j].h })
+		for _, pt := range points {
+			pl.ring = append(pl.ring, pt.h)
+			pl.ringNodes = append(pl.ringNodes, pt.node)
+		}
+	}
+	return pl
+}
+
+func (pl *placer) node(stripe int64, disk int) int {
+	n := pl.p.Nodes
+	switch pl.p.Policy {
+	case PlacementRandom:
+		// 以 (seed, 条带号) 为种子的部分 Fisher-Yates 洗牌
+		return declusteredDisk(int64(mix64(uint64(stripe))^uint64(pl.p.Seed)), disk, n)
+	case PlacementCHash:
+		h := mix64(uint64(stripe) ^ 0x5bd1e995)
+		i := sort.Search(len(pl.ring), func(i int) bool { return pl.ring[i] >= h })
+		seen := 0
+		var chosen [256]bool
+		var used []bool
+		if n <= len(chosen) {
+			used = chosen[:n]
+		} else {
+			used = make([]bool, n)
+		}
+		for j := 0; j < len(pl.ring); j++ {
+			node := pl.ringNodes[(i+j)%len(pl.ring)]
+			if used[node] {
+				continue
+			}
+			if seen == disk {
+				return node
+			}
+			used[node] = true
+			seen++
+		}
+		return disk % n
+	default:
+		return int((stripe*int64(pl.disks) + int64(disk)) % int64(n))
+	}
+}
+
+// loadImbalance 返回 max/mean 与变异系数
+func loadImbalance(loads []int64) (maxMean, cv float64) {
+	if len(loads) == 0 {
+		return 0, 0
+	}
+	var sum, max int64
+	for _, l := range loads {
+		sum += l
+		if l > max {
+			max = l
+		}
+	}
+	mean := float64(sum) / float64(len(loads))
+	if mean == 0 {
+		return 0, 0
+	}
+	var variance float64
+	for _, l := range loads {
+		d := float64(l) - mean
+		variance += d * d
+	}
+	variance /= float64(len(loads))
+	return float64(max) / mean, math.Sqrt(variance) / mean
+}
+
+func nodeOps(cps []CountPair) []int64 {
+	out := make([]int64, len(cps))
+	for i, cp := range cps {
+		out[i] = cp.Reads + cp.Writes
+	}
+	return out
+}
+
+// writeStripeNodeCSVs 输出 stripe_node_load.csv（按分钟按节点）、
+// stripe_node_imbalance.csv（按分钟的不均衡度，ALL 为全程）与 stripe_node_summary.csv（按总负载降序）
+func writeStripeNodeCSVs(dir string, st *stripeState) error {
+	if st.placer == nil {
+		return nil
+	}
+	st.mu.Lock()
+	keys := make([]string, 0, len(st.nodeMinute))
+	snapshot := make(map[string][]CountPair, len(st.nodeMinute))
+	for k, v := range st.nodeMinute {
+		keys = append(keys, k)
+		snapshot[k] = append([]CountPair(nil), v...)
+	}
+	st.mu.Unlock()
+	sort.Strings(keys)
+
+	nodes := st.cfg.Placement.Nodes
+	total := make([]CountPair, nodes)
+	var loadRows, imbRows [][]string
+	imbRow := func(key string, cps []CountPair) []string {
+		ops := nodeOps(cps)
+		maxMean, cv := loadImbalance(ops)
+		hottest := 0
+		for i := range ops {
+			if ops[i] > ops[hottest] {
+				hottest = i
+			}
+		}
+		return []string{key,
+			strconv.FormatInt(ops[hottest], 10),
+			strconv.FormatFloat(maxMean, 'f', 4, 64),
+			strconv.FormatFloat(cv, 'f', 4, 64),
+			strconv.Itoa(hottest),
+		}
+	}
+	for _, k := range keys {
+		cps := snapshot[k]
+		for n := range cps {
+			total[n].merge(&cps[n])
+			loadRows = append(loadRows, []string{k, strconv.Itoa(n),
+				strconv.FormatInt(cps[n].Reads, 10),
+				strconv.FormatInt(cps[n].Writes, 10),
+				strconv.FormatInt(cps[n].ReadBytes, 10),
+				strconv.FormatInt(cps[n].WriteBytes, 10),
+			})
+		}
+		imbRows = append(imbRows, imbRow(k, cps))
+	}
+	imbRows = append(imbRows, imbRow("ALL", total))
+
+	if err := writeCSV(filepath.Join(dir, "stripe_node_load.csv"),
+		[]string{"Minute", "Node", "Reads", "Writes", "ReadBytes", "WriteBytes"}, loadRows); err != nil {
+		return err
+	}
+	if err := writeCSV(filepath.Join(dir, "stripe_node_imbalance.csv"),
+		[]string{"Minute", "MaxNodeOps", "MaxMean", "CV", "HottestNode"}, imbRows); err != nil {
+		return err
+	}
+
+	order := make([]int, nodes)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return total[order[i]].Reads+total[order[i]].Writes > total[order[j]].Reads+total[order[j]].Writes
+	})
+	var sumRows [][]string
+	for rank, n := range order {
+		cp := total[n]
+		sumRows = append(sumRows, []string{
+			strconv.Itoa(rank + 1),
+			strconv.Itoa(n),
+			strconv.FormatInt(cp.Reads, 10),
+			strconv.FormatInt(cp.Writes, 10),
+			strconv.FormatInt(cp.Reads+cp.Writes, 10),
+			strconv.FormatInt(cp.ReadBytes, 10),
+			strconv.FormatInt(cp.WriteBytes, 10),
+		})
+	}
+	return writeCSV(filepath.Join(dir, "stripe_node_summary.csv"),
+		[]string{"Rank", "Node", "Reads", "Writes", "TotalOps", "ReadBytes", "WriteBytes"}, sumRows)
+}
@@ -1,128 +1,102 @@
 package main
 
 import (
-	"archive/tar"
-	"bufio"
-	"compress/gzip"
+	"archive/zip"
 	"fmt"
 	"io"
 	"os"
-	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 var scannerMaxBytes = 10 * 1024 * 1024
 func SetMaxLineBytes(n int) { if n > 0 { scannerMaxBytes = n } }
 
-func streamLinesFromTarGz(path string, lineCh chan<- string) (uint64, error) {
+// streamLinesAuto 打开 path，按文件头的魔数（而不是扩展名）识别压缩与归档格式，逐层解开后把文本行送往 out
+func streamLinesAuto(path string, out batchSink) (uint64, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return 0, err
 	}
 	defer f.Close()
 
-	gzr, err := gzip.NewReader(f)
-	if err != nil {
-		return 0, err
-	}
-	defer gzr.Close()
-
-	tr := tar.NewReader(gzr)
-	var n uint64
-	for {
-		header, err := tr.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return n, err
-		}
-		if header.Typeflag != tar.TypeReg {
-			continue
-		}
-		fmt.Printf("正在处理 tar 内文件: %s (size=%d)\n", header.Name, header.Size)
-		scanner := bufio.NewScanner(tr)
-		buf := make([]byte, 1024*1024)
-		scanner.Buffer(buf, scannerMaxBytes)
-
-		for scanner.Scan() {
-			line := scanner.Text()
-			if len(strings.TrimSpace(line)) == 0 {
-				continue
-			}
-			lineCh <- line
-			n++
-		}
-		if err := scanner.Err(); err != nil {
-			fmt.Printf("扫描文件 %s 错误: %v\n", header.Name, err)
-		}
-	}
-	return n, nil
-}
-
-func streamLinesFromPlainGz(path string, lineCh chan<- string) (uint64, error) {
-	f, err := os.Open(path)
-	if err != nil {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
 		return 0, err
 	}
-	defer f.Close()
-
-	gzr, err := gzip.NewReader(f)
-	if err != nil {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
 		return 0, err
 	}
-	defer gzr.Close()
-
-	scanner := bufio.NewScanner(gzr)
-	buf := make([]byte, 1024*1024)
-	scanner.Buffer(buf, scannerMaxBytes)
-
-	var n uint64
-	for scanner.Scan() {
-		line := scanner.Text()
-		if len(strings.TrimSpace(line)) == 0 {
-			continue
+	switch sniffFormat(head[:n]) {
+	case formatGzip:
+		// 顶层 gzip 直接在文件上解压，多成员文件可以并行
+		gzr, err := newGzipReader(f)
+		if err != nil {
+			return 0, err
 		}
-		lineCh <- line
-		n++
-	}
-	if err := scanner.Err(); err != nil {
-		fmt.Printf("扫描文件 %s 错误: %v\n", path, err)
-	}
-	return n, nil
-}
-
-func streamLinesFromPlainFile(path string, lineCh chan<- string) (uint64, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return 0, err
-	}
-	defer f.Close()
-
-	scanner := bufio.NewScanner(f)
-	buf := make([]byte, 1024*1024)
-	scanner.Buffer(buf, scannerMaxBytes)
-
-	var n uint64
-	for scanner.Scan() {
-		line := scanner.Text()
-		if len(strings.TrimSpace(line)) == 0 {
-			continue
+		defer gzr.Close()
+		return streamNested(gzr, path, out, 1)
+	case formatZip:
+		fi, err := f.Stat()
+		if err != nil {
+			return 0, err
 		}
-		lineCh <- line
-		n++
-	}
-	if err := scanner.Err(); err != nil {
-		fmt.Printf("扫描文件 %s 错误: %v\n", path, err)
+		zr, err := zip.NewReader(f, fi.Size())
+		if err != nil {
+			return 0, err
+		}
+		return streamZip(zr, path, out, 1)
 	}
-	return n, nil
+	return streamNested(f, path, out, 0)
 }
 
-func streamLinesAuto(path string, lineCh chan<- string) (uint64, error) {
-	if strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz") {
-		return streamLinesFromTarGz(path, lineCh)
+// streamFiles 用 readers 个 goroutine 并发读取 paths 送往 batchCh。done 非 nil 时每个文件的批次都带上进度跟踪，
+// 文件的记录全部聚合后其 fileProgress 被送往 done（done 的缓冲需不少于文件数）。
+// 批次按送出顺序编号；readers > 1 时各文件的批次交错编号，文件内部保持行序。
+// 单个文件读取失败（打不开、压缩数据损坏或截断）时打印错误并继续读取其余文件，已送出的记录照常聚合；
+// 全部读完后若有失败的文件，返回失败文件数与第一个错误
+func streamFiles(paths []string, readers int, batchCh chan<- *lineBatch, done chan<- *fileProgress) error {
+	readers = max(min(readers, len(paths)), 1)
+	var next atomic.Int64
+	var mu sync.Mutex
+	var failed int
+	var firstErr error
+	var wg sync.WaitGroup
+	order := &batchOrder{}
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1)) - 1
+				if i >= len(paths) {
+					return
+				}
+				out := batchSink{ch: batchCh, order: order}
+				if done != nil {
+					out.file = newFileProgress(paths[i], done)
+				}
+				cnt, err := streamLinesAuto(paths[i], out)
+				if err != nil {
+					fmt.Printf("读取 trace 文件 %s 失败，跳过该文件的剩余部分: %v\n", paths[i], err)
+					mu.Lock()
+					if failed == 0 {
+						firstErr = err
+					}
+					failed++
+					mu.Unlock()
+				}
+				if out.file != nil {
+					out.file.lines = cnt
+					out.file.release()
+				}
+			}
+		}()
 	}
-	if strings.HasSuffix(path, ".gz") {
-		return streamLinesFromPlainGz(path, lineCh)
+	wg.Wait()
+	if failed > 0 {
+		return fmt.Errorf("%d 个文件读取失败，第一个错误: %w", failed, firstErr)
 	}
-	return streamLinesFromPlainFile(path, lineCh)
+	return nil
 }
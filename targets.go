@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// volumeSelector 决定哪些卷参与条带分析：显式 ID 集合与正则任一命中即可
+type volumeSelector struct {
+	ids map[string]bool
+	re  *regexp.Regexp
+}
+
+func newVolumeSelector(ids []string, pattern string) (*volumeSelector, error) {
+	sel := &volumeSelector{ids: make(map[string]bool, len(ids))}
+	for _, id := range ids {
+		if id = strings.TrimSpace(id); id != "" {
+			sel.ids[id] = true
+		}
+	}
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target regex: %w", err)
+		}
+		sel.re = re
+	}
+	if len(sel.ids) == 0 && sel.re == nil {
+		return nil, nil
+	}
+	return sel, nil
+}
+
+func (s *volumeSelector) match(vol string) bool {
+	if s.ids[vol] {
+		return true
+	}
+	return s.re != nil && s.re.MatchString(vol)
+}
+
+// readVolumeIDFile 读取每行一个卷 ID 的文件，忽略空行与 # 注释
+func readVolumeIDFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var ids []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ids = append(ids, line)
+	}
+	return ids, sc.Err()
+}
+
+// topVolumeIDs 按总 IO 数返回最繁忙的 n 个卷
+func topVolumeIDs(counts map[string]*CountPair, n int) []string {
+	rows := generateVolumeRows(counts)
+	if len(rows) > n {
+		rows = rows[:n]
+	}
+	ids := make([]string, len(rows))
+	for i, r := range rows {
+		ids[i] = r.vid
+	}
+	return ids
+}
+
+// scanVolumeCounts 预扫描所有 trace 文件，只统计每个卷的读写次数（遵循 -from/-to），用于挑选 top N 卷
+func scanVolumeCounts(paths []string, p Parser, workers, readers, queueSize int, from, to *time.Time) (map[string]*CountPair, error) {
+	batchCh := make(chan *lineBatch, queueSize)
+	locals := make([]map[string]*CountPair, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		local := make(map[string]*CountPair)
+		locals[i] = local
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range batchCh {
+				b.forEachLine(func(line []byte, _ uint64) {
+					rec, err := p.ParseBytes(line)
+					if err != nil {
+						return
+					}
+					if (from != nil && rec.Timestamp.Before(*from)) || (to != nil && rec.Timestamp.After(*to)) {
+						return
+					}
+					cp, ok := local[rec.Volume]
+					if !ok {
+						cp = &CountPair{}
+						local[rec.Volume] = cp
+					}
+					cp.add(rec.IsRead(), rec.Length)
+				})
+				putBatch(b)
+			}
+		}()
+	}
+	readErr := streamFiles(paths, readers, batchCh, nil)
+	close(batchCh)
+	wg.Wait()
+	if readErr != nil {
+		// 出错的文件在正式读取时还会再报告一次，这里按已读到的记录挑选
+		fmt.Printf("预扫描时 %v，按已读到的记录挑选目标卷\n", readErr)
+	}
+
+	counts := make(map[string]*CountPair)
+	for _, local := range locals {
+		for vol, cp := range local {
+			if dst, ok := counts[vol]; ok {
+				dst.merge(cp)
+			} else {
+				counts[vol] = cp
+			}
+		}
+	}
+	return counts, nil
+}
+
+// stripesFor 返回卷 vol 的条带统计，首次遇到命中的卷时按所有条带配置创建；未命中的卷缓存为 nil
+func (ag *Aggregator) stripesFor(vol string) []*stripeState {
+	ag.stripesMu.RLock()
+	states, ok := ag.volStripes[vol]
+	ag.stripesMu.RUnlock()
+	if ok {
+		return states
+	}
+
+	ag.stripesMu.Lock()
+	defer ag.stripesMu.Unlock()
+	if states, ok := ag.volStripes[vol]; ok {
+		return states
+	}
+	if ag.targets.match(vol) {
+		states = make([]*stripeState, len(ag.stripeCfgs))
+		for i, cfg := range ag.stripeCfgs {
+			states[i] = newStripeState(cfg)
+		}
+		ag.volStripes[vol] = states
+		if ag.opsBudget != nil {
+			ag.opsBudget.register(vol, states)
+		}
+	} else {
+		ag.volStripes[vol] = nil
+	}
+	return states
+}
+
+// targetVolumes 返回已出现过的目标卷（排序）
+func (ag *Aggregator) targetVolumes() []string {
+	ag.stripesMu.RLock()
+	defer ag.stripesMu.RUnlock()
+	vols := make([]string, 0)
+	for vol, states := range ag.volStripes {
+		if states != nil {
+			vols = append(vols, vol)
+		}
+	}
+	sort.Strings(vols)
+	return vols
+}
@@ -0,0 +1,50 @@
+package trace
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// SplitFields 按逗号切分一行不含引号的 CSV，字段去掉首尾空白后追加到 dst 并返回。
+// 切出的字段直接引用 line 的内存，不做拷贝；line 中出现双引号时返回 ok=false，
+// 调用方应退回 encoding/csv 处理转义与引号内的逗号。
+func SplitFields(line []byte, dst [][]byte) (fields [][]byte, ok bool) {
+	if bytes.IndexByte(line, '"') >= 0 {
+		return dst, false
+	}
+	for {
+		i := bytes.IndexByte(line, ',')
+		if i < 0 {
+			return append(dst, bytes.TrimSpace(line)), true
+		}
+		dst = append(dst, bytes.TrimSpace(line[:i]))
+		line = line[i+1:]
+	}
+}
+
+// ParseInt 解析十进制整数字段，纯数字的常见情况不分配内存；
+// 其余输入（符号、溢出、非法字符）交给 strconv.ParseInt 以保持相同的错误信息
+func ParseInt(b []byte) (int64, error) {
+	if len(b) == 0 || len(b) > 18 {
+		return strconv.ParseInt(string(b), 10, 64)
+	}
+	var n int64
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return strconv.ParseInt(string(b), 10, 64)
+		}
+		n = n*10 + int64(c-'0')
+	}
+	return n, nil
+}
+
+// ParseOpBytes 是 ParseOp 的 []byte 版本，常见写法直接匹配，其余交给 ParseOp
+func ParseOpBytes(b []byte) OpKind {
+	switch string(b) {
+	case "R", "r", "Read", "read", "READ", "0", "Read(0)":
+		return OpRead
+	case "W", "w", "Write", "write", "WRITE", "1", "Write(1)":
+		return OpWrite
+	}
+	return ParseOp(string(b))
+}
@@ -0,0 +1,157 @@
+// Package trace 定义各 provider 共用的 IO 记录类型与解析错误。
+package trace
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// OpKind 表示一次 IO 的操作类型
+type OpKind uint8
+
+const (
+	OpRead OpKind = iota
+	OpWrite
+)
+
+func (k OpKind) String() string {
+	if k == OpRead {
+		return "Read"
+	}
+	return "Write"
+}
+
+// SourcePos 记录一条记录在原始 trace 中的位置
+type SourcePos struct {
+	File string // 文件路径（tar 包内为 "包路径:成员名"）
+	Line uint64 // 从 1 开始的行号
+}
+
+func (p SourcePos) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("line %d", p.Line)
+	}
+	return fmt.Sprintf("%s:%d", p.File, p.Line)
+}
+
+// IORecord 是一条解析后的块 IO 记录
+type IORecord struct {
+	Timestamp time.Time
+	Op        OpKind
+	Volume    string
+	Offset    int64
+	Length    int64
+
+	// Latency 仅当 HasLatency 为 true 时有效（例如 MSRC 的 ResponseTime）
+	Latency    time.Duration
+	HasLatency bool
+
+	// 可选的来源信息，provider 不提供时为空
+	Host   string
+	Tenant string
+
+	Source SourcePos
+}
+
+func (r *IORecord) IsRead() bool  { return r.Op == OpRead }
+func (r *IORecord) IsWrite() bool { return r.Op == OpWrite }
+
+// ErrHeader 表示该行是 CSV 表头而非数据
+var ErrHeader = errors.New("header line")
+
+// ParseError 描述一行解析失败的原因
+type ParseError struct {
+	Pos    SourcePos
+	Field  string // 出错的字段名，整行错误时为空
+	Value  string
+	Reason string
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	var b strings.Builder
+	if e.Pos.Line > 0 || e.Pos.File != "" {
+		b.WriteString(e.Pos.String())
+		b.WriteString(": ")
+	}
+	if e.Field != "" {
+		fmt.Fprintf(&b, "field %s=%q: ", e.Field, e.Value)
+	}
+	b.WriteString(e.Reason)
+	if e.Err != nil {
+		b.WriteString(": ")
+		b.WriteString(e.Err.Error())
+	}
+	return b.String()
+}
+
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// Errorf 构造一个整行级别的解析错误
+func Errorf(format string, args ...any) *ParseError {
+	return &ParseError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// FieldError 构造一个字段级别的解析错误
+func FieldError(field, value string, err error) *ParseError {
+	return &ParseError{Field: field, Value: value, Reason: "invalid value", Err: err}
+}
+
+// HeaderError 返回表头行对应的解析错误
+func HeaderError() *ParseError {
+	return &ParseError{Reason: "skipped", Err: ErrHeader}
+}
+
+var unknownOpWarnCount uint64
+
+// ParseOp 更健壮的 IO type 解析，支持 "Read(0)"、"Write(1)"、"0"、"1"、"R"、"W" 等格式
+func ParseOp(s string) OpKind {
+	s = strings.TrimSpace(s)
+	s = strings.Trim(s, "\"")
+	l := strings.ToLower(s)
+
+	// try extract digit inside parentheses anywhere
+	if idx := strings.Index(l, "("); idx >= 0 {
+		if j := strings.Index(l[idx:], ")"); j >= 0 {
+			switch strings.TrimSpace(l[idx+1 : idx+j]) {
+			case "0":
+				return OpRead
+			case "1":
+				return OpWrite
+			}
+		}
+	}
+
+	// explicit words
+	if strings.Contains(l, "read") {
+		return OpRead
+	}
+	if strings.Contains(l, "write") {
+		return OpWrite
+	}
+
+	// plain digits
+	if l == "0" {
+		return OpRead
+	}
+	if l == "1" {
+		return OpWrite
+	}
+
+	// prefix check
+	if strings.HasPrefix(l, "r") {
+		return OpRead
+	}
+	if strings.HasPrefix(l, "w") {
+		return OpWrite
+	}
+
+	// fallback: conservative treat as write
+	if atomic.AddUint64(&unknownOpWarnCount, 1) <= 100 {
+		fmt.Printf("警告: 未知 IOType='%s'，按 write 处理\n", s)
+	}
+	return OpWrite
+}
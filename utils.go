@@ -29,6 +29,22 @@ func calculateReadRatioPercent(reads, total int64) string {
 	return "0"
 }
 
+// Helper: Calculate throughput (MB/s) string
+func calculateMBps(bytes int64, seconds float64) string {
+	if seconds <= 0 {
+		return "0"
+	}
+	return fmt.Sprintf("%.3f", float64(bytes)/(1024*1024)/seconds)
+}
+
+// Helper: Calculate average request size (bytes) string
+func calculateAvgSize(bytes, ops int64) string {
+	if ops > 0 {
+		return fmt.Sprintf("%.1f", float64(bytes)/float64(ops))
+	}
+	return "0"
+}
+
 // Helper: Write generic CSV
 func writeCSV(path string, header []string, rows [][]string) error {
 	f, err := os.Create(path)
@@ -53,7 +69,8 @@ func writeCSV(path string, header []string, rows [][]string) error {
 }
 
 // Generic function to write time-based stats (Day/Hour/Minute)
-func writeTimeStats(path string, statsMap map[string]*CountPair, timeHeader string, mu *sync.RWMutex) error {
+// bucketSeconds 为每个时间桶的长度，用于计算吞吐
+func writeTimeStats(path string, statsMap map[string]*CountPair, timeHeader string, bucketSeconds float64, mu *sync.RWMutex) error {
 	mu.RLock()
 	keys := make([]string, 0, len(statsMap))
 	for k := range statsMap {
@@ -69,18 +86,27 @@ func writeTimeStats(path string, statsMap map[string]*CountPair, timeHeader stri
 
 	sort.Strings(keys)
 
-	header := []string{timeHeader, "Reads", "Writes", "TotalOps", "Read/Write Ratio (read:write)"}
+	header := []string{timeHeader, "Reads", "Writes", "TotalOps", "Read/Write Ratio (read:write)",
+		"ReadBytes", "WriteBytes", "TotalBytes", "ReadMB/s", "WriteMB/s", "TotalMB/s", "AvgReqSize(B)"}
 	rows := make([][]string, 0, len(keys))
 
 	for _, k := range keys {
 		cp := snapshot[k]
 		total := cp.Reads + cp.Writes
+		totalBytes := cp.ReadBytes + cp.WriteBytes
 		rows = append(rows, []string{
 			k,
 			strconv.FormatInt(cp.Reads, 10),
 			strconv.FormatInt(cp.Writes, 10),
 			strconv.FormatInt(total, 10),
 			calculateRatio(cp.Reads, cp.Writes),
+			strconv.FormatInt(cp.ReadBytes, 10),
+			strconv.FormatInt(cp.WriteBytes, 10),
+			strconv.FormatInt(totalBytes, 10),
+			calculateMBps(cp.ReadBytes, bucketSeconds),
+			calculateMBps(cp.WriteBytes, bucketSeconds),
+			calculateMBps(totalBytes, bucketSeconds),
+			calculateAvgSize(totalBytes, total),
 		})
 	}
 	return writeCSV(path, header, rows)
@@ -88,43 +114,59 @@ func writeTimeStats(path string, statsMap map[string]*CountPair, timeHeader stri
 
 // writeDayCSV 输出每天统计
 func writeDayCSV(path string, ag *Aggregator) error {
-	return writeTimeStats(path, ag.dayMap, "Date", &ag.dayMu)
+	return writeTimeStats(path, ag.dayMap, "Date", 86400, &ag.dayMu)
 }
 
 // writeHourCSV 输出每小时统计
 func writeHourCSV(path string, ag *Aggregator) error {
-	return writeTimeStats(path, ag.hourMap, "Hour", &ag.hourMu)
+	return writeTimeStats(path, ag.hourMap, "Hour", 3600, &ag.hourMu)
 }
 
 // writeMinuteCSV 输出每分钟统计
 func writeMinuteCSV(path string, ag *Aggregator) error {
-	return writeTimeStats(path, ag.minuteMap, "Minute", &ag.minuteMu)
+	return writeTimeStats(path, ag.minuteMap, "Minute", 60, &ag.minuteMu)
 }
 
 // Helper for volume rows generation
 type volRow struct {
-	vid                  string
-	reads, writes, total int64
+	vid                   string
+	reads, writes, total  int64
+	readBytes, writeBytes int64
 }
 
 func generateVolumeRows(mv map[string]*CountPair) []volRow {
 	rows := make([]volRow, 0, len(mv))
 	for vid, cp := range mv {
-		rows = append(rows, volRow{vid: vid, reads: cp.Reads, writes: cp.Writes, total: cp.Reads + cp.Writes})
+		rows = append(rows, volRow{
+			vid: vid, reads: cp.Reads, writes: cp.Writes, total: cp.Reads + cp.Writes,
+			readBytes: cp.ReadBytes, writeBytes: cp.WriteBytes,
+		})
 	}
 	sort.Slice(rows, func(i, j int) bool { return rows[i].total > rows[j].total })
 	return rows
 }
 
-func formatVolumeRows(vRows []volRow) [][]string {
+var volumeHeader = []string{"VolumeID", "Reads", "Writes", "TotalOps", "ReadRatio(%)",
+	"ReadBytes", "WriteBytes", "TotalBytes", "ReadMB/s", "WriteMB/s", "TotalMB/s", "AvgReqSize(B)"}
+
+// seconds 为统计时长，用于计算吞吐
+func formatVolumeRows(vRows []volRow, seconds float64) [][]string {
 	rows := make([][]string, len(vRows))
 	for i, r := range vRows {
+		totalBytes := r.readBytes + r.writeBytes
 		rows[i] = []string{
 			r.vid,
 			strconv.FormatInt(r.reads, 10),
 			strconv.FormatInt(r.writes, 10),
 			strconv.FormatInt(r.total, 10),
 			calculateReadRatioPercent(r.reads, r.total),
+			strconv.FormatInt(r.readBytes, 10),
+			strconv.FormatInt(r.writeBytes, 10),
+			strconv.FormatInt(totalBytes, 10),
+			calculateMBps(r.readBytes, seconds),
+			calculateMBps(r.writeBytes, seconds),
+			calculateMBps(totalBytes, seconds),
+			calculateAvgSize(totalBytes, r.total),
 		}
 	}
 	return rows
@@ -136,13 +178,18 @@ func writeVolumeCSV(path string, ag *Aggregator) error {
 	// Create a snapshot
 	snapshot := make(map[string]*CountPair, len(ag.volMap))
 	for k, v := range ag.volMap {
-		snapshot[k] = &CountPair{Reads: v.Reads, Writes: v.Writes}
+		c := *v
+		snapshot[k] = &c
 	}
+	// 统计时长取实际出现的时间跨度，至少 1 秒
+	seconds := ag.lastTs.Sub(ag.firstTs).Seconds()
 	ag.volMu.RUnlock()
+	if seconds < 1 {
+		seconds = 1
+	}
 
 	vRows := generateVolumeRows(snapshot)
-	header := []string{"VolumeID", "Reads", "Writes", "TotalOps", "ReadRatio(%)"}
-	return writeCSV(path, header, formatVolumeRows(vRows))
+	return writeCSV(path, volumeHeader, formatVolumeRows(vRows, seconds))
 }
 
 func readVolumeStatsCSV(path string) (map[string]*CountPair, error) {
@@ -170,7 +217,13 @@ func readVolumeStatsCSV(path string) (map[string]*CountPair, error) {
 		vid := row[0]
 		reads, _ := strconv.ParseInt(row[1], 10, 64)
 		writes, _ := strconv.ParseInt(row[2], 10, 64)
-		res[vid] = &CountPair{Reads: reads, Writes: writes}
+		cp := &CountPair{Reads: reads, Writes: writes}
+		// 旧版本输出不含字节列
+		if len(row) >= 7 {
+			cp.ReadBytes, _ = strconv.ParseInt(row[5], 10, 64)
+			cp.WriteBytes, _ = strconv.ParseInt(row[6], 10, 64)
+		}
+		res[vid] = cp
 	}
 	return res, nil
 }
@@ -202,13 +255,11 @@ func writeMinuteVolumeCSV(dir string, minuteKey string, mv map[string]*CountPair
 		if _, ok := data[vid]; !ok {
 			data[vid] = &CountPair{}
 		}
-		data[vid].Reads += cp.Reads
-		data[vid].Writes += cp.Writes
+		data[vid].merge(cp)
 	}
 
 	vRows := generateVolumeRows(data)
-	header := []string{"VolumeID", "Reads", "Writes", "TotalOps", "ReadRatio(%)"}
-	return writeCSV(fp, header, formatVolumeRows(vRows))
+	return writeCSV(fp, volumeHeader, formatVolumeRows(vRows, 60))
 }
 
 func writeVolumeByMinuteDir(dir string, ag *Aggregator, merge bool) error {
@@ -226,7 +277,8 @@ func writeVolumeByMinuteDir(dir string, ag *Aggregator, merge bool) error {
 		srcMv := ag.minuteVolMap[k]
 		dstMv := make(map[string]*CountPair, len(srcMv))
 		for vol, cp := range srcMv {
-			dstMv[vol] = &CountPair{Reads: cp.Reads, Writes: cp.Writes}
+			c := *cp
+			dstMv[vol] = &c
 		}
 		snapshot[k] = dstMv
 	}
@@ -236,7 +288,8 @@ func writeVolumeByMinuteDir(dir string, ag *Aggregator, merge bool) error {
 
 	for _, k := range keys {
 		mv := snapshot[k]
-		if err := writeMinuteVolumeCSV(dir, k, mv, merge); err != nil {
+		// 之前淘汰写出过的分钟总是合并，否则会覆盖已写出的部分
+		if err := writeMinuteVolumeCSV(dir, k, mv, merge || ag.evictedBefore(k)); err != nil {
 			return err
 		}
 	}
@@ -247,7 +300,8 @@ func printTopVolumes(ag *Aggregator, top int) {
 	ag.volMu.RLock()
 	snapshot := make(map[string]*CountPair, len(ag.volMap))
 	for k, v := range ag.volMap {
-		snapshot[k] = &CountPair{Reads: v.Reads, Writes: v.Writes}
+		c := *v
+		snapshot[k] = &c
 	}
 	ag.volMu.RUnlock()
 
@@ -261,82 +315,47 @@ func printTopVolumes(ag *Aggregator, top int) {
 	for i := 0; i < n; i++ {
 		r := vRows[i]
 		readRatio := 100.0 * float64(r.reads) / float64(maxInt64(1, r.total))
-		fmt.Printf("%2d) Volume %s: Reads=%d Writes=%d Total=%d ReadRatio=%.2f%%\n",
-			i+1, r.vid, r.reads, r.writes, r.total, readRatio)
+		fmt.Printf("%2d) Volume %s: Reads=%d Writes=%d Total=%d ReadRatio=%.2f%% Bytes=%d\n",
+			i+1, r.vid, r.reads, r.writes, r.total, readRatio, r.readBytes+r.writeBytes)
 	}
 }
 
-func writeStripeStats(path string, ag *Aggregator) error {
-	ag.stripeMu.Lock()
-	keys := make([]int, 0, len(ag.stripeUpdateMap))
-	for k := range ag.stripeUpdateMap {
-		keys = append(keys, k)
-	}
-	// Copy map data
-	statsCopy := make(map[int]int, len(ag.stripeUpdateMap))
-	for k, v := range ag.stripeUpdateMap {
-		statsCopy[k] = v
+// parseByteSize 解析 "4096"、"64K"、"1M"、"2G"、"1T" 形式的字节数（1024 进制）
+func parseByteSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	mult := int64(1)
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'K':
+			mult = 1 << 10
+		case 'M':
+			mult = 1 << 20
+		case 'G':
+			mult = 1 << 30
+		case 'T':
+			mult = 1 << 40
+		}
+		if mult > 1 {
+			s = s[:n-1]
+		}
 	}
-	ag.stripeMu.Unlock()
-
-	sort.Ints(keys)
-
-	header := []string{"UpdatedBlocksInStripe", "Count"}
-	rows := make([][]string, len(keys))
-	for i, k := range keys {
-		rows[i] = []string{strconv.Itoa(k), strconv.Itoa(statsCopy[k])}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
 	}
-	return writeCSV(path, header, rows)
+	return v * mult, nil
 }
 
-func writeStripeHeatMap(path string, ag *Aggregator) error {
-	ag.stripeMu.Lock()
-	stripeIDs := make([]int64, 0, len(ag.stripeBlockHeatMap))
-
-	// Deep copy needed
-	dataCopy := make(map[int64][]CountPair, len(ag.stripeBlockHeatMap))
-	for k, v := range ag.stripeBlockHeatMap {
-		stripeIDs = append(stripeIDs, k)
-		// Deep copy the slice
-		newSlice := make([]CountPair, len(v))
-		copy(newSlice, v)
-		dataCopy[k] = newSlice
-	}
-
-	// Capture config under lock
-	dBlocks := ag.dataBlocks
-	// pBlocks := ag.parityBlocks // not strictly needed for logic if we iterate all
-
-	ag.stripeMu.Unlock()
-
-	sort.Slice(stripeIDs, func(i, j int) bool { return stripeIDs[i] < stripeIDs[j] })
-
-	var rows [][]string
-	for _, sid := range stripeIDs {
-		counters := dataCopy[sid]
-		for idx := 0; idx < len(counters); idx++ {
-			reads := counters[idx].Reads
-			writes := counters[idx].Writes
-			if reads == 0 && writes == 0 {
-				continue
-			}
-			blockType := "Data"
-			if idx >= dBlocks {
-				blockType = "Parity"
-			}
-			rows = append(rows, []string{
-				strconv.FormatInt(sid, 10),
-				strconv.Itoa(idx),
-				blockType,
-				strconv.FormatInt(reads, 10),
-				strconv.FormatInt(writes, 10),
-				strconv.FormatInt(reads+writes, 10),
-			})
+// splitList 将逗号分隔的参数拆分为非空项
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
 		}
 	}
-
-	header := []string{"StripeID", "BlockIndex", "BlockType", "Reads", "Writes", "TotalOps"}
-	return writeCSV(path, header, rows)
+	return out
 }
 
 func maxInt64(a, b int64) int64 {
@@ -345,29 +364,3 @@ func maxInt64(a, b int64) int64 {
 	}
 	return b
 }
-
-// writeStripeOpsCSV 输出指定卷的详细条带操作日志
-func writeStripeOpsCSV(path string, ag *Aggregator) error {
-	ag.stripeMu.Lock()
-	// Copy slice
-	ops := make([]StripeOperation, len(ag.stripeOps))
-	copy(ops, ag.stripeOps)
-	ag.stripeMu.Unlock()
-
-	sort.Slice(ops, func(i, j int) bool {
-		return ops[i].OptionTime.Before(ops[j].OptionTime)
-	})
-
-	header := []string{"StripeID", "BlockIndex", "BlockType", "Read/Write", "OptionTime"}
-	rows := make([][]string, len(ops))
-	for i, op := range ops {
-		rows[i] = []string{
-			strconv.FormatInt(op.StripeID, 10),
-			strconv.Itoa(op.BlockIndex),
-			op.BlockType,
-			op.ReadWrite,
-			op.OptionTime.Format("2006-01-02 15:04:05.000000"),
-		}
-	}
-	return writeCSV(path, header, rows)
-}
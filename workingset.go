@@ -0,0 +1,250 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"ana/trace"
+)
+
+// blockSet 统计不同 block 的数量：数量较小时使用精确的稀疏位图，
+// 超过 exactLimit 后转换为 HyperLogLog 估计
+type blockSet struct {
+	pages map[int64]*[64]uint64 // 每页 4096 个 block
+	count int64
+	hll   *hyperLogLog
+}
+
+const wsPageBits = 4096
+
+func (bs *blockSet) add(block int64, exactLimit int64, hllPrecision uint8) {
+	if bs.hll != nil {
+		bs.hll.addHash(mix64(uint64(block)))
+		return
+	}
+	if bs.pages == nil {
+		bs.pages = make(map[int64]*[64]uint64)
+	}
+	pg, ok := bs.pages[block/wsPageBits]
+	if !ok {
+		pg = &[64]uint64{}
+		bs.pages[block/wsPageBits] = pg
+	}
+	bit := block % wsPageBits
+	word, mask := bit/64, uint64(1)<<(bit%64)
+	if pg[word]&mask != 0 {
+		return
+	}
+	pg[word] |= mask
+	bs.count++
+	if exactLimit > 0 && bs.count > exactLimit {
+		bs.toHLL(hllPrecision)
+	}
+}
+
+func (bs *blockSet) toHLL(p uint8) {
+	h := newHyperLogLog(p)
+	for pageID, pg := range bs.pages {
+		for w, bitsSet := range pg {
+			for b := 0; b < 64; b++ {
+				if bitsSet&(1<<b) != 0 {
+					h.addHash(mix64(uint64(pageID*wsPageBits + int64(w*64+b))))
+				}
+			}
+		}
+	}
+	bs.pages = nil
+	bs.hll = h
+}
+
+func (bs *blockSet) size() (n int64, estimated bool) {
+	if bs.hll != nil {
+		return bs.hll.estimate(), true
+	}
+	return bs.count, false
+}
+
+// wsWindow 一个时间窗口内的读、写、并集 footprint
+type wsWindow struct {
+	read, write, union blockSet
+}
+
+type wsResult struct {
+	read, write, union int64
+	estimated          bool
+}
+
+func (w *wsWindow) result() wsResult {
+	r, e1 := w.read.size()
+	wr, e2 := w.write.size()
+	u, e3 := w.union.size()
+	return wsResult{read: r, write: wr, union: u, estimated: e1 || e2 || e3}
+}
+
+// 统计粒度
+const (
+	wsMinute = iota
+	wsHour
+	wsDay
+	wsTotal
+	wsGranularities
+)
+
+var wsGranularityNames = [wsGranularities]string{"minute", "hour", "day", "total"}
+
+// wsOpenWindows 每个粒度同时保留的未结束窗口数，用于容忍 worker 间的轻微乱序
+const wsOpenWindows = 2
+
+// workingSetStats 按卷统计每分钟/小时/天以及全程的不同 block 数
+type workingSetStats struct {
+	mu           sync.Mutex
+	blockSize    int64
+	exactLimit   int64
+	hllPrecision uint8
+
+	// open[vol][granularity][windowKey]
+	open map[string]*[wsGranularities]map[string]*wsWindow
+	// done[granularity][windowKey][vol]
+	done [wsGranularities]map[string]map[string]wsResult
+}
+
+func newWorkingSetStats(blockSize, exactLimit int64, hllPrecision uint8) *workingSetStats {
+	ws := &workingSetStats{
+		blockSize:    blockSize,
+		exactLimit:   exactLimit,
+		hllPrecision: hllPrecision,
+		open:         make(map[string]*[wsGranularities]map[string]*wsWindow),
+	}
+	for g := range ws.done {
+		ws.done[g] = make(map[string]map[string]wsResult)
+	}
+	return ws
+}
+
+func (ws *workingSetStats) closeWindow(g int, key, vol string, w *wsWindow) {
+	m, ok := ws.done[g][key]
+	if !ok {
+		m = make(map[string]wsResult)
+		ws.done[g][key] = m
+	}
+	m[vol] = w.result()
+}
+
+func (ws *workingSetStats) observe(rec *trace.IORecord, minuteKey, hourKey, dayKey string) {
+	// 负 offset 得到的 block 号无法放入位图
+	if rec.Length <= 0 || rec.Offset < 0 {
+		return
+	}
+	startBlock, endBlock := blockRange(rec.Offset, rec.Length, ws.blockSize)
+	keys := [wsGranularities]string{minuteKey, hourKey, dayKey, ""}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	vw, ok := ws.open[rec.Volume]
+	if !ok {
+		vw = &[wsGranularities]map[string]*wsWindow{}
+		for g := range vw {
+			vw[g] = make(map[string]*wsWindow)
+		}
+		ws.open[rec.Volume] = vw
+	}
+	for g := 0; g < wsGranularities; g++ {
+		w, ok := vw[g][keys[g]]
+		if !ok {
+			w = &wsWindow{}
+			vw[g][keys[g]] = w
+			if len(vw[g]) > wsOpenWindows {
+				// 关闭最早的窗口
+				oldest := ""
+				for k := range vw[g] {
+					if oldest == "" || k < oldest {
+						oldest = k
+					}
+				}
+				ws.closeWindow(g, oldest, rec.Volume, vw[g][oldest])
+				delete(vw[g], oldest)
+			}
+		}
+		for b := startBlock; b <= endBlock; b++ {
+			if rec.IsRead() {
+				w.read.add(b, ws.exactLimit, ws.hllPrecision)
+			} else {
+				w.write.add(b, ws.exactLimit, ws.hllPrecision)
+			}
+			w.union.add(b, ws.exactLimit, ws.hllPrecision)
+		}
+	}
+}
+
+// finish 关闭所有未结束窗口
+func (ws *workingSetStats) finish() {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	for vol, vw := range ws.open {
+		for g := range vw {
+			for k, w := range vw[g] {
+				ws.closeWindow(g, k, vol, w)
+			}
+		}
+	}
+	ws.open = make(map[string]*[wsGranularities]map[string]*wsWindow)
+}
+
+// writeWorkingSetCSVs 输出 working_set_minute/hour/day/total.csv
+func writeWorkingSetCSVs(outDir string, ag *Aggregator) error {
+	ws := ag.workingSet
+	if ws == nil {
+		return nil
+	}
+	ws.finish()
+	keyHeaders := [wsGranularities]string{"Minute", "Hour", "Date", ""}
+	for g := 0; g < wsGranularities; g++ {
+		ws.mu.Lock()
+		done := ws.done[g]
+		keys := make([]string, 0, len(done))
+		for k := range done {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var rows [][]string
+		for _, k := range keys {
+			vols := make([]string, 0, len(done[k]))
+			for v := range done[k] {
+				vols = append(vols, v)
+			}
+			sort.Strings(vols)
+			for _, v := range vols {
+				r := done[k][v]
+				row := []string{}
+				if g != wsTotal {
+					row = append(row, k)
+				}
+				row = append(row, v,
+					strconv.FormatInt(r.read, 10),
+					strconv.FormatInt(r.write, 10),
+					strconv.FormatInt(r.union, 10),
+					strconv.FormatInt(r.read*ws.blockSize, 10),
+					strconv.FormatInt(r.write*ws.blockSize, 10),
+					strconv.FormatInt(r.union*ws.blockSize, 10),
+					strconv.FormatBool(r.estimated),
+				)
+				rows = append(rows, row)
+			}
+		}
+		ws.mu.Unlock()
+
+		header := []string{}
+		if g != wsTotal {
+			header = append(header, keyHeaders[g])
+		}
+		header = append(header, "VolumeID", "ReadBlocks", "WriteBlocks", "UnionBlocks",
+			"ReadFootprint(B)", "WriteFootprint(B)", "UnionFootprint(B)", "Estimated")
+		path := filepath.Join(outDir, "working_set_"+wsGranularityNames[g]+".csv")
+		if err := writeCSV(path, header, rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}